@@ -1,17 +1,22 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
-	"github.com/golang-collections/collections/queue"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/pkg/errors" // to avoid errors from docker lib
 	"log"
+	"orc/domain/core/scheduler"
 	"orc/domain/entities"
+	"orc/internal/infrastructure/docker"
+	"orc/internal/infrastructure/store"
 	"orc/internal/services/manager"
 	"orc/internal/services/worker"
+	"orc/pkg/xqueue"
 	"os"
 	"strconv"
+	"time"
 )
 
 func main() {
@@ -37,23 +42,68 @@ func main() {
 	fmt.Printf("Starting Orc worker-3 at %s:%d\n", whost, wport+2)
 	fmt.Printf("Starting Orc manager at %s:%d\n", mhost, mport)
 
+	rt, err := docker.NewDocker()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	registryAuths := make(map[string]entities.RegistryAuth)
+	if path := os.Getenv("ORC_REGISTRY_AUTH_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = json.Unmarshal(data, &registryAuths)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	concurrency := 0
+	if v := os.Getenv("ORC_WORKER_CONCURRENCY"); v != "" {
+		concurrency, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var resync time.Duration
+	if v := os.Getenv("ORC_RESYNC_PERIOD"); v != "" {
+		resync, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	worker1 := worker.Worker{
-		Name:      "test-worker-1",
-		Queue:     *queue.New(),
-		Db:        make(map[uuid.UUID]*entities.Task),
-		TaskCount: 0,
+		Name:          "test-worker-1",
+		Queue:         xqueue.NewQueue[entities.TaskEvent](),
+		Db:            store.NewMemory[uuid.UUID, entities.Task](),
+		TaskCount:     0,
+		Runtime:       rt,
+		RegistryAuths: registryAuths,
+		Concurrency:   concurrency,
+		ResyncPeriod:  resync,
 	}
 	worker2 := worker.Worker{
-		Name:      "test-worker-2",
-		Queue:     *queue.New(),
-		Db:        make(map[uuid.UUID]*entities.Task),
-		TaskCount: 0,
+		Name:          "test-worker-2",
+		Queue:         xqueue.NewQueue[entities.TaskEvent](),
+		Db:            store.NewMemory[uuid.UUID, entities.Task](),
+		TaskCount:     0,
+		Runtime:       rt,
+		RegistryAuths: registryAuths,
+		Concurrency:   concurrency,
+		ResyncPeriod:  resync,
 	}
 	worker3 := worker.Worker{
-		Name:      "test-worker-3",
-		Queue:     *queue.New(),
-		Db:        make(map[uuid.UUID]*entities.Task),
-		TaskCount: 0,
+		Name:          "test-worker-3",
+		Queue:         xqueue.NewQueue[entities.TaskEvent](),
+		Db:            store.NewMemory[uuid.UUID, entities.Task](),
+		TaskCount:     0,
+		Runtime:       rt,
+		RegistryAuths: registryAuths,
+		Concurrency:   concurrency,
+		ResyncPeriod:  resync,
 	}
 
 	workerApi1 := worker.API{
@@ -76,6 +126,7 @@ func main() {
 	}
 
 	go worker1.RunTasks()
+	go worker1.CollectStats()
 	go worker1.UpdateTasks()
 	go func() {
 		err = workerApi1.Start()
@@ -85,6 +136,7 @@ func main() {
 	}()
 
 	go worker2.RunTasks()
+	go worker2.CollectStats()
 	go worker2.UpdateTasks()
 	go func() {
 		err = workerApi2.Start()
@@ -94,6 +146,7 @@ func main() {
 	}()
 
 	go worker3.RunTasks()
+	go worker3.CollectStats()
 	go worker3.UpdateTasks()
 	go func() {
 		err = workerApi3.Start()
@@ -108,7 +161,27 @@ func main() {
 		fmt.Sprintf("%s:%d", whost, wport+2),
 	}
 
-	m := manager.NewManager(workers, "roundrobin")
+	schedulerType := os.Getenv("ORC_SCHEDULER")
+	if schedulerType == "" {
+		schedulerType = "roundrobin"
+	}
+	profiles := scheduler.DefaultProfiles()
+	if path := os.Getenv("ORC_SCHEDULER_PROFILE"); path != "" {
+		profile, err := scheduler.LoadProfile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		profiles = scheduler.WithProfile(profiles, profile)
+		schedulerType = profile.Name
+	}
+	profile, ok := profiles[schedulerType]
+	if !ok {
+		log.Printf("Unknown scheduler %s, using roundrobin\n", schedulerType)
+		profile = profiles["roundrobin"]
+	}
+
+	m := manager.NewManager(workers, profile)
+	m.ResyncPeriod = resync
 	managerApi := manager.API{
 		Address: mhost,
 		Port:    mport,
@@ -118,6 +191,7 @@ func main() {
 
 	go m.ProcessTasks()
 	go m.UpdateTasks()
+	go m.UpdateNodeStats()
 	go m.DoHealthChecks()
 	err = managerApi.Start()
 	if err != nil {
@@ -0,0 +1,25 @@
+package scheduler
+
+import "orc/domain/entities"
+
+// BinPack places tasks on the most allocated node that still fits them,
+// keeping the remaining nodes free for large tasks.
+type BinPack struct {
+	Name string
+}
+
+func (b *BinPack) SelectCandidateNodes(task entities.Task, nodes []*entities.Node) []*entities.Node {
+	return selectCandidates(task, nodes)
+}
+
+func (b *BinPack) Score(task entities.Task, nodes []*entities.Node) map[string]float64 {
+	nodeScores := make(map[string]float64)
+	for _, node := range nodes {
+		nodeScores[node.Name] = 1 - utilization(task, node)
+	}
+	return nodeScores
+}
+
+func (b *BinPack) Pick(scores map[string]float64, candidates []*entities.Node) *entities.Node {
+	return pickLowest(scores, candidates)
+}
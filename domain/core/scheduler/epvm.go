@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"math"
+	"orc/domain/entities"
+)
+
+// LIEB is the base of the E-PVM cost function. Each resource contributes
+// LIEB^utilization to the cost of a node, so loading an already busy node
+// costs more than loading an idle one.
+const LIEB = 1.53960071783900203869
+
+const epvmMaxJobs = 4.0
+
+type Epvm struct {
+	Name string
+}
+
+func (e *Epvm) SelectCandidateNodes(task entities.Task, nodes []*entities.Node) []*entities.Node {
+	return selectCandidates(task, nodes)
+}
+
+// Score returns the marginal cost of placing the task on each node: the
+// difference between the node's cost with the task's cpu and memory added
+// and its current cost.
+func (e *Epvm) Score(task entities.Task, nodes []*entities.Node) map[string]float64 {
+	nodeScores := make(map[string]float64)
+
+	for _, node := range nodes {
+		jobCost := math.Pow(LIEB, float64(node.TaskCount+1)/epvmMaxJobs) -
+			math.Pow(LIEB, float64(node.TaskCount)/epvmMaxJobs)
+
+		cpuLoad := nodeCPULoad(node)
+		newCPULoad := cpuLoad
+		if node.Cores > 0 {
+			newCPULoad += task.CPU / float64(node.Cores)
+		}
+		cpuCost := math.Pow(LIEB, newCPULoad) - math.Pow(LIEB, cpuLoad) + jobCost
+
+		memCost := jobCost
+		memTotal, memUsed := nodeMemoryKb(node)
+		if memTotal > 0 {
+			memLoad := memUsed / memTotal
+			newMemLoad := (memUsed + float64(task.Memory)/1024) / memTotal
+			memCost += math.Pow(LIEB, newMemLoad) - math.Pow(LIEB, memLoad)
+		}
+
+		nodeScores[node.Name] = cpuCost + memCost
+	}
+
+	return nodeScores
+}
+
+func (e *Epvm) Pick(scores map[string]float64, candidates []*entities.Node) *entities.Node {
+	return pickLowest(scores, candidates)
+}
+
+func nodeCPULoad(node *entities.Node) float64 {
+	if node.Stats == nil || node.Stats.CPUStats == nil {
+		return 0
+	}
+	return node.Stats.CPUsage()
+}
+
+// nodeMemoryKb returns the node's total memory and the memory in use or
+// already promised to tasks, both in kilobytes.
+func nodeMemoryKb(node *entities.Node) (float64, float64) {
+	allocated := float64(node.MemoryAllocated) / 1024
+	if node.Stats == nil || node.Stats.MemStats == nil {
+		return float64(node.Memory) / 1024, allocated
+	}
+	return float64(node.Stats.MemTotalKb()), float64(node.Stats.MemUsedKb()) + allocated
+}
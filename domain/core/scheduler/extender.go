@@ -0,0 +1,146 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"orc/domain/entities"
+	"time"
+)
+
+const defaultExtenderTimeout = 5 * time.Second
+
+// ExtenderConfig points the scheduler at an external HTTP service that can
+// reject candidate nodes and adjust their scores. With FailOpen an unreachable
+// or failing extender is ignored, otherwise it rejects every node.
+type ExtenderConfig struct {
+	URL       string
+	TimeoutMs int
+	FailOpen  bool
+	Weight    float64
+}
+
+type ExtenderArgs struct {
+	Task  entities.Task
+	Nodes []*entities.Node
+}
+
+// ExtenderResult is the extender's reply. If Nodes is set only the named nodes
+// pass, FailedNodes rejects nodes with a reason and Scores is added to the
+// node scores, scaled by the configured weight (1 if unset).
+type ExtenderResult struct {
+	Nodes       []string
+	FailedNodes map[string]string
+	Scores      map[string]float64
+	Error       string
+}
+
+type Extender struct {
+	Config ExtenderConfig
+	client *http.Client
+}
+
+func NewExtender(config ExtenderConfig) (*Extender, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("extender has no url")
+	}
+	timeout := defaultExtenderTimeout
+	if config.TimeoutMs > 0 {
+		timeout = time.Duration(config.TimeoutMs) * time.Millisecond
+	}
+	return &Extender{
+		Config: config,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// call sends the task and nodes to the extender without registry credentials.
+func (e *Extender) call(task entities.Task, nodes []*entities.Node) (*ExtenderResult, error) {
+	args := ExtenderArgs{Task: task.Redacted(), Nodes: make([]*entities.Node, 0, len(nodes))}
+	for _, node := range nodes {
+		args.Nodes = append(args.Nodes, node.Redacted())
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling extender args: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.Config.URL, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("error creating extender request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling extender %s: %v", e.Config.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("extender %s returned status %d", e.Config.URL, resp.StatusCode)
+	}
+
+	var result ExtenderResult
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding extender response: %v", err)
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("extender %s: %s", e.Config.URL, result.Error)
+	}
+	return &result, nil
+}
+
+// Filter asks the extender which nodes may run the task. It returns the
+// passing nodes, the reasons the others were rejected, and the extender's
+// weighted score adjustments.
+func (e *Extender) Filter(task entities.Task, nodes []*entities.Node) ([]*entities.Node, map[string]string, map[string]float64) {
+	rejected := make(map[string]string)
+	if len(nodes) == 0 {
+		return nodes, rejected, nil
+	}
+
+	result, err := e.call(task, nodes)
+	if err != nil {
+		if e.Config.FailOpen {
+			return nodes, rejected, nil
+		}
+		for _, node := range nodes {
+			rejected[node.Name] = err.Error()
+		}
+		return nil, rejected, nil
+	}
+
+	var allowed map[string]bool
+	if result.Nodes != nil {
+		allowed = make(map[string]bool, len(result.Nodes))
+		for _, name := range result.Nodes {
+			allowed[name] = true
+		}
+	}
+
+	var passed []*entities.Node
+	for _, node := range nodes {
+		if reason, ok := result.FailedNodes[node.Name]; ok {
+			rejected[node.Name] = fmt.Sprintf("rejected by extender: %s", reason)
+			continue
+		}
+		if allowed != nil && !allowed[node.Name] {
+			rejected[node.Name] = "rejected by extender"
+			continue
+		}
+		passed = append(passed, node)
+	}
+
+	weight := e.Config.Weight
+	if weight == 0 {
+		weight = 1
+	}
+	scores := make(map[string]float64, len(result.Scores))
+	for name, score := range result.Scores {
+		scores[name] = weight * score
+	}
+	return passed, rejected, scores
+}
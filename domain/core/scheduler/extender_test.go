@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"orc/domain/entities"
+	"testing"
+)
+
+func extenderNodes() []*entities.Node {
+	return []*entities.Node{
+		entities.NewNode("a", "http://a", "worker"),
+		entities.NewNode("b", "http://b", "worker"),
+		entities.NewNode("c", "http://c", "worker"),
+	}
+}
+
+func newExtenderFramework(t *testing.T, config ExtenderConfig) *Framework {
+	t.Helper()
+	f, err := NewFramework(Profile{Name: "test", Extenders: []ExtenderConfig{config}})
+	if err != nil {
+		t.Fatalf("NewFramework: %v", err)
+	}
+	return f
+}
+
+func TestExtenderRejectsAndScores(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var args ExtenderArgs
+		if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+			t.Errorf("decoding extender args: %v", err)
+		}
+		if len(args.Nodes) != 3 {
+			t.Errorf("extender got %d nodes, want 3", len(args.Nodes))
+		}
+		if auth := args.Task.RegistryAuth; auth == nil || auth.Password != "" || auth.Username != "ci" {
+			t.Errorf("extender got registry auth %+v, want username only", auth)
+		}
+		json.NewEncoder(w).Encode(ExtenderResult{
+			FailedNodes: map[string]string{"b": "no gpu"},
+			Scores:      map[string]float64{"a": 1},
+		})
+	}))
+	defer srv.Close()
+
+	f := newExtenderFramework(t, ExtenderConfig{URL: srv.URL, Weight: 2})
+	task := entities.Task{Name: "t", RegistryAuth: &entities.RegistryAuth{Username: "ci", Password: "secret"}}
+	d := Decide(f, task, extenderNodes())
+
+	if d.Node == nil || d.Node.Name != "c" {
+		t.Fatalf("picked %v, want c", d.Node)
+	}
+	if d.Rejected["b"] != "rejected by extender: no gpu" {
+		t.Errorf("rejection of b = %q", d.Rejected["b"])
+	}
+	if d.Scores["a"] != 2 {
+		t.Errorf("score of a = %v, want 2", d.Scores["a"])
+	}
+}
+
+func TestExtenderFailure(t *testing.T) {
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		// The request context is only cancelled once the body is read.
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		failOpen bool
+	}{
+		{"timeout fail closed", slow, false},
+		{"timeout fail open", slow, true},
+		{"error fail closed", failing, false},
+		{"error fail open", failing, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			f := newExtenderFramework(t, ExtenderConfig{URL: srv.URL, TimeoutMs: 50, FailOpen: tt.failOpen})
+			d := Decide(f, entities.Task{Name: "t"}, extenderNodes())
+
+			if tt.failOpen {
+				if d.Node == nil || len(d.Candidates) != 3 {
+					t.Fatalf("fail open kept %d candidates, want 3", len(d.Candidates))
+				}
+				return
+			}
+			if d.Node != nil {
+				t.Fatalf("fail closed picked %s, want no node", d.Node.Name)
+			}
+			if len(d.Rejected) != 3 {
+				t.Errorf("fail closed rejected %d nodes, want 3", len(d.Rejected))
+			}
+		})
+	}
+}
+
+func TestExtenderPreemption(t *testing.T) {
+	rejecting := func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ExtenderResult{FailedNodes: map[string]string{"a": "no gpu"}})
+	}
+	accepting := func(w http.ResponseWriter, r *http.Request) {
+		var args ExtenderArgs
+		json.NewDecoder(r.Body).Decode(&args)
+		for _, node := range args.Nodes {
+			if len(node.Tasks) != 0 {
+				t.Errorf("extender got node %s with %d tasks, want its victims released", node.Name, len(node.Tasks))
+			}
+		}
+		json.NewEncoder(w).Encode(ExtenderResult{})
+	}
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		failOpen bool
+		preempt  bool
+	}{
+		{"accepted", accepting, false, true},
+		{"rejected", rejecting, false, false},
+		{"error fail closed", failing, false, false},
+		{"error fail open", failing, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			f := newExtenderFramework(t, ExtenderConfig{URL: srv.URL, FailOpen: tt.failOpen})
+			f.filters = DefaultFilters
+			low := placedTask("low", 1, 512)
+			nodes := []*entities.Node{preemptNode("a", 512, low)}
+			sim := Simulate(f, entities.Task{Name: "t", Priority: 5, Memory: 512}, nodes)
+
+			if !tt.preempt {
+				if sim.Node != "" || len(sim.Preempt) != 0 {
+					t.Fatalf("preempted %v on %q, want no node", sim.Preempt, sim.Node)
+				}
+				return
+			}
+			if sim.Node != "a" || len(sim.Preempt) != 1 || sim.Preempt[0] != low.ID {
+				t.Fatalf("preempted %v on %q, want [low] on a", sim.Preempt, sim.Node)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"orc/domain/entities"
+)
+
+var ErrUnschedulable = errors.New("task is unschedulable")
+
+// Filter reports why the node cannot run the task, or nil if it can.
+type Filter func(t entities.Task, n *entities.Node) error
+
+var filterPlugins = map[string]Filter{
+	"resources": checkResources,
+	"labels":    checkLabels,
+	"affinity":  checkTaskAffinity,
+	"taints":    checkTaints,
+	"ports":     checkPorts,
+}
+
+var defaultFilterNames = []string{"resources", "labels", "affinity", "taints", "ports"}
+
+// DefaultFilters is the filter chain of the built-in profiles.
+var DefaultFilters = func() []Filter {
+	filters := make([]Filter, len(defaultFilterNames))
+	for i, name := range defaultFilterNames {
+		filters[i] = filterPlugins[name]
+	}
+	return filters
+}()
+
+// FilterNodes splits nodes into the ones passing every filter and the reasons
+// the others were rejected, keyed by node name.
+func FilterNodes(t entities.Task, nodes []*entities.Node, filters []Filter) ([]*entities.Node, map[string]string) {
+	var candidates []*entities.Node
+	rejected := make(map[string]string)
+	for _, node := range nodes {
+		var reason error
+		for _, filter := range filters {
+			if reason = filter(t, node); reason != nil {
+				break
+			}
+		}
+		if reason != nil {
+			rejected[node.Name] = reason.Error()
+			continue
+		}
+		candidates = append(candidates, node)
+	}
+	return candidates, rejected
+}
+
+func selectCandidates(t entities.Task, nodes []*entities.Node) []*entities.Node {
+	candidates, _ := FilterNodes(t, nodes, DefaultFilters)
+	return candidates
+}
+
+// checkResources reports why the node cannot hold the task, or nil if it fits.
+// A zero capacity means it has not been discovered yet and is not checked.
+func checkResources(t entities.Task, n *entities.Node) error {
+	if t.CPU > 0 && n.Cores > 0 && n.FreeCores() < t.CPU {
+		return fmt.Errorf("insufficient cpu: requested %.2f, free %.2f", t.CPU, n.FreeCores())
+	}
+	if t.Memory > 0 && n.Memory > 0 && n.FreeMemory() < t.Memory {
+		return fmt.Errorf("insufficient memory: requested %d, free %d", t.Memory, n.FreeMemory())
+	}
+	if t.Disk > 0 && n.Disk > 0 && n.FreeDisk() < t.Disk {
+		return fmt.Errorf("insufficient disk: requested %d, free %d", t.Disk, n.FreeDisk())
+	}
+	return nil
+}
+
+// checkLabels matches the node labels against the task's node selector and
+// required node affinity.
+func checkLabels(t entities.Task, n *entities.Node) error {
+	if err := checkNodeSelector(t, n); err != nil {
+		return err
+	}
+	return checkNodeAffinity(t, n)
+}
+
+func checkNodeSelector(t entities.Task, n *entities.Node) error {
+	for key, value := range t.NodeSelector {
+		if v, ok := n.Labels[key]; !ok || v != value {
+			return fmt.Errorf("node selector %s=%s not matched", key, value)
+		}
+	}
+	return nil
+}
+
+func checkNodeAffinity(t entities.Task, n *entities.Node) error {
+	if t.Affinity == nil {
+		return nil
+	}
+	for _, req := range t.Affinity.NodeAffinity {
+		if !req.Matches(n.Labels) {
+			return fmt.Errorf("node affinity %s %s %v not matched", req.Key, req.Operator, req.Values)
+		}
+	}
+	return nil
+}
+
+func checkTaskAffinity(t entities.Task, n *entities.Node) error {
+	if t.Affinity == nil {
+		return nil
+	}
+	if len(t.Affinity.TaskAffinity) > 0 {
+		found := false
+		for id, placed := range n.Tasks {
+			if id != t.ID && entities.MatchLabels(t.Affinity.TaskAffinity, placed.Labels) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("task affinity %v: no matching task on node", t.Affinity.TaskAffinity)
+		}
+	}
+	if len(t.Affinity.TaskAntiAffinity) > 0 {
+		for id, placed := range n.Tasks {
+			if id != t.ID && entities.MatchLabels(t.Affinity.TaskAntiAffinity, placed.Labels) {
+				return fmt.Errorf("task anti-affinity %v: conflicts with task %s", t.Affinity.TaskAntiAffinity, id)
+			}
+		}
+	}
+	return nil
+}
+
+func checkTaints(t entities.Task, n *entities.Node) error {
+	for _, effect := range []entities.TaintEffect{entities.TaintNoSchedule, entities.TaintNoExecute} {
+		if taints := t.UntoleratedTaints(n, effect); len(taints) > 0 {
+			taint := taints[0]
+			return fmt.Errorf("untolerated taint %s=%s:%s", taint.Key, taint.Value, taint.Effect)
+		}
+	}
+	return nil
+}
+
+func checkPorts(t entities.Task, n *entities.Node) error {
+	requested := t.HostPortBindings()
+	if len(requested) == 0 {
+		return nil
+	}
+	for id, placed := range n.Tasks {
+		if id == t.ID {
+			continue
+		}
+		if port, ok := entities.ConflictingHostPort(requested, placed.HostPortBindings()); ok {
+			return fmt.Errorf("host port %s already used by task %s", port, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"github.com/google/uuid"
+	"orc/domain/entities"
+	"testing"
+)
+
+func TestCheckPorts(t *testing.T) {
+	placed := entities.Task{ID: uuid.New(), Name: "web", PortBindings: map[string]string{"80/tcp": "8080"}}
+
+	tests := []struct {
+		name     string
+		bindings map[string]string
+		conflict bool
+	}{
+		{"same host port", map[string]string{"8000/tcp": "8080"}, true},
+		{"same host port on a host ip", map[string]string{"8000/tcp": "127.0.0.1:8080"}, true},
+		{"other host port", map[string]string{"80/tcp": "8081"}, false},
+		{"other protocol", map[string]string{"80/udp": "8080"}, false},
+		{"no bindings", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := entities.NewNode("a", "http://a", "worker")
+			node.Allocate(placed)
+			task := entities.Task{ID: uuid.New(), Name: "t", PortBindings: tt.bindings}
+
+			err := checkPorts(task, node)
+			if tt.conflict && err == nil {
+				t.Fatal("no conflict reported")
+			}
+			if !tt.conflict && err != nil {
+				t.Fatalf("unexpected conflict: %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckPortsIgnoresTaskItself(t *testing.T) {
+	task := entities.Task{ID: uuid.New(), Name: "web", PortBindings: map[string]string{"80/tcp": "8080"}}
+	node := entities.NewNode("a", "http://a", "worker")
+	node.Allocate(task)
+
+	if err := checkPorts(task, node); err != nil {
+		t.Fatalf("task conflicts with itself: %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"orc/domain/entities"
+	"os"
+)
+
+// Profile composes a scheduler out of registered filter and score plugins.
+type Profile struct {
+	Name      string
+	Filters   []string
+	Scores    []WeightedScore
+	Extenders []ExtenderConfig
+}
+
+type WeightedScore struct {
+	Name   string
+	Weight float64
+}
+
+// DefaultProfiles returns the built-in profiles keyed by name. Each call
+// returns a new map, so callers may add their own profiles to it.
+func DefaultProfiles() map[string]Profile {
+	return map[string]Profile{
+		"roundrobin": {
+			Name:    "roundrobin",
+			Filters: defaultFilterNames,
+			Scores:  []WeightedScore{{Name: "roundrobin", Weight: 1}, {Name: "taints", Weight: 1}},
+		},
+		"epvm": {
+			Name:    "epvm",
+			Filters: defaultFilterNames,
+			Scores:  []WeightedScore{{Name: "epvm", Weight: 1}, {Name: "taints", Weight: 1}},
+		},
+		"binpack": {
+			Name:    "binpack",
+			Filters: defaultFilterNames,
+			Scores:  []WeightedScore{{Name: "binpack", Weight: 1}, {Name: "taints", Weight: 1}},
+		},
+		"spread": {
+			Name:    "spread",
+			Filters: defaultFilterNames,
+			Scores:  []WeightedScore{{Name: "spread", Weight: 1}, {Name: "taints", Weight: 1}},
+		},
+	}
+}
+
+// WithProfile returns a copy of profiles with the profile added under its
+// name, replacing any profile of the same name.
+func WithProfile(profiles map[string]Profile, profile Profile) map[string]Profile {
+	merged := make(map[string]Profile, len(profiles)+1)
+	for name, p := range profiles {
+		merged[name] = p
+	}
+	merged[profile.Name] = profile
+	return merged
+}
+
+// LoadProfile reads a profile from a JSON file and checks that it names only
+// known plugins.
+func LoadProfile(path string) (Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	var profile Profile
+	err = json.Unmarshal(data, &profile)
+	if err != nil {
+		return Profile{}, fmt.Errorf("error parsing scheduler profile %s: %v", path, err)
+	}
+	if profile.Name == "" {
+		return Profile{}, fmt.Errorf("scheduler profile %s has no name", path)
+	}
+	_, err = NewFramework(profile)
+	if err != nil {
+		return Profile{}, err
+	}
+	return profile, nil
+}
+
+type weightedPlugin struct {
+	plugin ScorePlugin
+	weight float64
+}
+
+// Framework is a Scheduler built from a Profile. A node must pass every filter
+// plugin and extender, and the node with the lowest weighted sum of plugin
+// and extender scores is picked.
+type Framework struct {
+	Name      string
+	filters   []Filter
+	scores    []weightedPlugin
+	extenders []*Extender
+}
+
+func NewFramework(profile Profile) (*Framework, error) {
+	f := &Framework{Name: profile.Name}
+	for _, name := range profile.Filters {
+		filter, ok := filterPlugins[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter plugin %q in profile %s", name, profile.Name)
+		}
+		f.filters = append(f.filters, filter)
+	}
+	for _, score := range profile.Scores {
+		newPlugin, ok := scorePlugins[score.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown score plugin %q in profile %s", score.Name, profile.Name)
+		}
+		f.scores = append(f.scores, weightedPlugin{plugin: newPlugin(), weight: score.Weight})
+	}
+	for _, config := range profile.Extenders {
+		extender, err := NewExtender(config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extender in profile %s: %v", profile.Name, err)
+		}
+		f.extenders = append(f.extenders, extender)
+	}
+	return f, nil
+}
+
+func (f *Framework) Filters() []Filter {
+	return f.filters
+}
+
+// FilterWithReasons runs the filter plugins and then the extenders, returning
+// the candidates, the reasons the other nodes were rejected and the
+// extenders' score adjustments for the candidates.
+func (f *Framework) FilterWithReasons(task entities.Task, nodes []*entities.Node) ([]*entities.Node, map[string]string, map[string]float64) {
+	candidates, rejected := FilterNodes(task, nodes, f.filters)
+	candidates, adjustments := f.extend(task, candidates, rejected)
+	return candidates, rejected, adjustments
+}
+
+// extend runs the extenders over the candidates, adding the nodes they reject
+// to rejected. It returns the remaining candidates and the extenders' score
+// adjustments.
+func (f *Framework) extend(task entities.Task, candidates []*entities.Node, rejected map[string]string) ([]*entities.Node, map[string]float64) {
+	adjustments := make(map[string]float64)
+	for _, extender := range f.extenders {
+		var extRejected map[string]string
+		var extScores map[string]float64
+		candidates, extRejected, extScores = extender.Filter(task, candidates)
+		for name, reason := range extRejected {
+			rejected[name] = reason
+		}
+		for name, score := range extScores {
+			adjustments[name] += score
+		}
+	}
+	return candidates, adjustments
+}
+
+func (f *Framework) SelectCandidateNodes(task entities.Task, nodes []*entities.Node) []*entities.Node {
+	candidates, _, _ := f.FilterWithReasons(task, nodes)
+	return candidates
+}
+
+// Score returns the weighted sum of the plugin scores. Extender scores are
+// only known after filtering and are added by Decide.
+func (f *Framework) Score(task entities.Task, nodes []*entities.Node) map[string]float64 {
+	nodeScores := make(map[string]float64)
+	for _, node := range nodes {
+		nodeScores[node.Name] = 0
+	}
+	for _, wp := range f.scores {
+		for name, score := range wp.plugin.Score(task, nodes) {
+			nodeScores[name] += wp.weight * score
+		}
+	}
+	return nodeScores
+}
+
+func (f *Framework) Pick(scores map[string]float64, candidates []*entities.Node) *entities.Node {
+	return pickLowest(scores, candidates)
+}
+
+// Decision is the outcome of scheduling a task. Node is nil if every node was
+// rejected.
+type Decision struct {
+	Node       *entities.Node
+	Candidates []*entities.Node
+	Rejected   map[string]string
+	Scores     map[string]float64
+}
+
+// Decide filters the nodes for the task, scores the candidates and picks one,
+// recording why the other nodes were rejected.
+func Decide(s Scheduler, task entities.Task, nodes []*entities.Node) Decision {
+	var d Decision
+	var adjustments map[string]float64
+	if f, ok := s.(interface {
+		FilterWithReasons(entities.Task, []*entities.Node) ([]*entities.Node, map[string]string, map[string]float64)
+	}); ok {
+		d.Candidates, d.Rejected, adjustments = f.FilterWithReasons(task, nodes)
+	} else {
+		d.Candidates, d.Rejected = FilterNodes(task, nodes, FiltersOf(s))
+	}
+	if len(d.Candidates) == 0 {
+		d.Scores = make(map[string]float64)
+		return d
+	}
+
+	d.Scores = s.Score(task, d.Candidates)
+	for name, score := range adjustments {
+		if _, ok := d.Scores[name]; ok {
+			d.Scores[name] += score
+		}
+	}
+	d.Node = s.Pick(d.Scores, d.Candidates)
+	return d
+}
+
+// FiltersOf returns the filter chain the scheduler selects candidates with.
+func FiltersOf(s Scheduler) []Filter {
+	if f, ok := s.(interface{ Filters() []Filter }); ok {
+		return f.Filters()
+	}
+	return DefaultFilters
+}
@@ -0,0 +1,64 @@
+package scheduler
+
+import "orc/domain/entities"
+
+// ScorePlugin rates every candidate node for the task. Lower scores are
+// better, matching Pick.
+type ScorePlugin interface {
+	Score(task entities.Task, nodes []*entities.Node) map[string]float64
+}
+
+// scorePlugins builds a fresh instance of each plugin, so stateful plugins
+// like roundrobin are not shared between profiles.
+var scorePlugins = map[string]func() ScorePlugin{
+	"roundrobin":    func() ScorePlugin { return &RoundRobin{Name: "roundrobin"} },
+	"epvm":          func() ScorePlugin { return &Epvm{Name: "epvm"} },
+	"binpack":       func() ScorePlugin { return &BinPack{Name: "binpack"} },
+	"spread":        func() ScorePlugin { return &Spread{Name: "spread"} },
+	"resources":     func() ScorePlugin { return scoreFunc(utilization) },
+	"labels":        func() ScorePlugin { return scoreFunc(scoreLabels) },
+	"imagelocality": func() ScorePlugin { return scoreFunc(scoreImageLocality) },
+	"taints":        func() ScorePlugin { return scoreFunc(scoreTaints) },
+}
+
+// scoreFunc adapts a stateless per-node scoring function to ScorePlugin.
+type scoreFunc func(task entities.Task, node *entities.Node) float64
+
+func (f scoreFunc) Score(task entities.Task, nodes []*entities.Node) map[string]float64 {
+	nodeScores := make(map[string]float64)
+	for _, node := range nodes {
+		nodeScores[node.Name] = f(task, node)
+	}
+	return nodeScores
+}
+
+// scoreLabels returns the fraction of the task's preferred node affinity
+// requirements the node does not match.
+func scoreLabels(task entities.Task, node *entities.Node) float64 {
+	if task.Affinity == nil || len(task.Affinity.PreferredNodeAffinity) == 0 {
+		return 0
+	}
+	var unmatched int
+	for _, req := range task.Affinity.PreferredNodeAffinity {
+		if !req.Matches(node.Labels) {
+			unmatched++
+		}
+	}
+	return float64(unmatched) / float64(len(task.Affinity.PreferredNodeAffinity))
+}
+
+// scoreImageLocality prefers nodes already running a task with the same
+// image, which most likely have the image pulled.
+func scoreImageLocality(task entities.Task, node *entities.Node) float64 {
+	for _, placed := range node.Tasks {
+		if placed.Image == task.Image {
+			return 0
+		}
+	}
+	return 1
+}
+
+// scoreTaints counts the PreferNoSchedule taints the task does not tolerate.
+func scoreTaints(task entities.Task, node *entities.Node) float64 {
+	return float64(len(task.UntoleratedTaints(node, entities.TaintPreferNoSchedule)))
+}
@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"orc/domain/entities"
+	"slices"
+	"sort"
+)
+
+// Preempt looks for the node where stopping the fewest lower priority tasks
+// lets the task pass every filter. It returns the node and the tasks to stop,
+// or nil if the task cannot be placed even by preemption.
+func Preempt(task entities.Task, nodes []*entities.Node, filters []Filter) (*entities.Node, []entities.Task) {
+	return pickPreemption(preemptions(task, nodes, filters))
+}
+
+// PreemptWith is Preempt with the scheduler's filters. The scheduler's
+// extenders are asked about each node as it would be once its victims are
+// stopped, and the nodes they reject are not preempted on.
+func PreemptWith(s Scheduler, task entities.Task, nodes []*entities.Node) (*entities.Node, []entities.Task) {
+	plans := preemptions(task, nodes, FiltersOf(s))
+	if f, ok := s.(*Framework); ok && len(f.extenders) > 0 && len(plans) > 0 {
+		sims := make([]*entities.Node, len(plans))
+		for i, p := range plans {
+			sims[i] = p.sim
+		}
+		passed, _ := f.extend(task, sims, make(map[string]string))
+		plans = slices.DeleteFunc(plans, func(p preemption) bool {
+			return !slices.Contains(passed, p.sim)
+		})
+	}
+	return pickPreemption(plans)
+}
+
+// preemption is a way to make room for a task on node: sim is the node with
+// the victims released.
+type preemption struct {
+	node    *entities.Node
+	sim     *entities.Node
+	victims []entities.Task
+}
+
+func preemptions(task entities.Task, nodes []*entities.Node, filters []Filter) []preemption {
+	var plans []preemption
+	for _, node := range nodes {
+		victims, sim, ok := selectVictims(task, node, filters)
+		if ok {
+			plans = append(plans, preemption{node: node, sim: sim, victims: victims})
+		}
+	}
+	return plans
+}
+
+// pickPreemption returns the plan stopping the fewest tasks, breaking ties by
+// the lowest total priority.
+func pickPreemption(plans []preemption) (*entities.Node, []entities.Task) {
+	var bestNode *entities.Node
+	var bestVictims []entities.Task
+	bestCost := 0
+	for _, p := range plans {
+		cost := 0
+		for _, victim := range p.victims {
+			cost += victim.Priority
+		}
+		if bestNode == nil || len(p.victims) < len(bestVictims) ||
+			(len(p.victims) == len(bestVictims) && cost < bestCost) {
+			bestNode = p.node
+			bestVictims = p.victims
+			bestCost = cost
+		}
+	}
+	return bestNode, bestVictims
+}
+
+// selectVictims releases the node's lower priority tasks on a copy of the
+// node, lowest priority first, until the task fits. It then reprieves the
+// victims the task does not need, highest priority first, and returns the
+// victims with the copy of the node they were released from.
+func selectVictims(task entities.Task, node *entities.Node, filters []Filter) ([]entities.Task, *entities.Node, bool) {
+	var lower []entities.Task
+	for _, placed := range node.Tasks {
+		if placed.Priority < task.Priority {
+			lower = append(lower, placed)
+		}
+	}
+	if len(lower) == 0 {
+		return nil, nil, false
+	}
+	sort.Slice(lower, func(i, j int) bool {
+		if lower[i].Priority != lower[j].Priority {
+			return lower[i].Priority < lower[j].Priority
+		}
+		return lower[i].ID.String() < lower[j].ID.String()
+	})
+
+	sim := node.Clone()
+	fits := func() bool {
+		candidates, _ := FilterNodes(task, []*entities.Node{sim}, filters)
+		return len(candidates) > 0
+	}
+
+	n := 0
+	for n < len(lower) && !fits() {
+		sim.Release(lower[n])
+		n++
+	}
+	if !fits() {
+		return nil, nil, false
+	}
+
+	var victims []entities.Task
+	for i := n - 1; i >= 0; i-- {
+		sim.Allocate(lower[i])
+		if fits() {
+			continue
+		}
+		sim.Release(lower[i])
+		victims = append(victims, lower[i])
+	}
+	slices.Reverse(victims)
+	return victims, sim, true
+}
@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"github.com/google/uuid"
+	"orc/domain/entities"
+	"testing"
+)
+
+func preemptNode(name string, memory int64, placed ...entities.Task) *entities.Node {
+	n := entities.NewNode(name, "http://"+name, "worker")
+	n.Memory = memory
+	for _, t := range placed {
+		n.Allocate(t)
+	}
+	return n
+}
+
+func placedTask(name string, priority int, memory int64) entities.Task {
+	return entities.Task{ID: uuid.New(), Name: name, Priority: priority, Memory: memory}
+}
+
+func TestPreempt(t *testing.T) {
+	low := placedTask("low", 1, 512)
+	mid := placedTask("mid", 2, 512)
+	big := placedTask("big", 2, 1024)
+	high := placedTask("high", 10, 1024)
+	small1 := placedTask("small1", 1, 256)
+	small2 := placedTask("small2", 1, 256)
+
+	tests := []struct {
+		name    string
+		task    entities.Task
+		nodes   []*entities.Node
+		node    string
+		victims []string
+	}{
+		{
+			name:    "lowest priority first",
+			task:    entities.Task{Name: "t", Priority: 5, Memory: 512},
+			nodes:   []*entities.Node{preemptNode("a", 1024, low, mid)},
+			node:    "a",
+			victims: []string{"low"},
+		},
+		{
+			name:    "reprieves victims the task does not need",
+			task:    entities.Task{Name: "t", Priority: 5, Memory: 1024},
+			nodes:   []*entities.Node{preemptNode("a", 1536, small1, small2, big)},
+			node:    "a",
+			victims: []string{"big"},
+		},
+		{
+			name: "fewest victims across nodes",
+			task: entities.Task{Name: "t", Priority: 5, Memory: 512},
+			nodes: []*entities.Node{
+				preemptNode("a", 512, small1, small2),
+				preemptNode("b", 512, low),
+			},
+			node:    "b",
+			victims: []string{"low"},
+		},
+		{
+			name: "cheapest victims on a tie",
+			task: entities.Task{Name: "t", Priority: 5, Memory: 512},
+			nodes: []*entities.Node{
+				preemptNode("a", 512, mid),
+				preemptNode("b", 512, low),
+			},
+			node:    "b",
+			victims: []string{"low"},
+		},
+		{
+			name:  "higher priority tasks are not preempted",
+			task:  entities.Task{Name: "t", Priority: 5, Memory: 512},
+			nodes: []*entities.Node{preemptNode("a", 1024, high)},
+		},
+		{
+			name:  "does not fit even when empty",
+			task:  entities.Task{Name: "t", Priority: 5, Memory: 2048},
+			nodes: []*entities.Node{preemptNode("a", 1024, low, mid)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, victims := Preempt(tt.task, tt.nodes, DefaultFilters)
+			if tt.node == "" {
+				if node != nil {
+					t.Fatalf("picked %s with victims %v, want none", node.Name, victims)
+				}
+				return
+			}
+			if node == nil || node.Name != tt.node {
+				t.Fatalf("picked %v, want %s", node, tt.node)
+			}
+			var names []string
+			for _, v := range victims {
+				names = append(names, v.Name)
+			}
+			if len(names) != len(tt.victims) {
+				t.Fatalf("victims = %v, want %v", names, tt.victims)
+			}
+			for i := range names {
+				if names[i] != tt.victims[i] {
+					t.Fatalf("victims = %v, want %v", names, tt.victims)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectVictimsLeavesNodeUntouched(t *testing.T) {
+	low := placedTask("low", 1, 512)
+	node := preemptNode("a", 512, low)
+
+	victims, _, ok := selectVictims(entities.Task{Name: "t", Priority: 5, Memory: 512}, node, DefaultFilters)
+	if !ok || len(victims) != 1 {
+		t.Fatalf("victims = %v, %v, want [low]", victims, ok)
+	}
+	if _, placed := node.Tasks[low.ID]; !placed || node.MemoryAllocated != 512 {
+		t.Errorf("node changed by victim selection: %+v", node)
+	}
+}
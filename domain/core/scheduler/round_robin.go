@@ -7,9 +7,8 @@ type RoundRobin struct {
 	LastWorker int
 }
 
-func (r *RoundRobin) SelectCandidateNodes(_ entities.Task, nodes []*entities.Node) []*entities.Node {
-	// TODO: алгоритм выбора подходящего кандидата
-	return nodes
+func (r *RoundRobin) SelectCandidateNodes(task entities.Task, nodes []*entities.Node) []*entities.Node {
+	return selectCandidates(task, nodes)
 }
 
 func (r *RoundRobin) Score(_ entities.Task, nodes []*entities.Node) map[string]float64 {
@@ -36,20 +35,12 @@ func (r *RoundRobin) Score(_ entities.Task, nodes []*entities.Node) map[string]f
 }
 
 func (r *RoundRobin) Pick(scores map[string]float64, candidates []*entities.Node) *entities.Node {
-	var bestNode *entities.Node
-	var lowestScore float64
-	for idx, node := range candidates {
-		if idx == 0 {
-			bestNode = node
-			lowestScore = scores[node.Name]
-			continue
-		}
+	return pickLowest(scores, candidates)
+}
 
-		if scores[node.Name] < lowestScore {
-			bestNode = node
-			lowestScore = scores[node.Name]
-		}
+func (r *RoundRobin) snapshot() func() {
+	lastWorker := r.LastWorker
+	return func() {
+		r.LastWorker = lastWorker
 	}
-
-	return bestNode
 }
@@ -7,3 +7,45 @@ type Scheduler interface {
 	Score(task entities.Task, nodes []*entities.Node) map[string]float64
 	Pick(scores map[string]float64, candidates []*entities.Node) *entities.Node
 }
+
+func pickLowest(scores map[string]float64, candidates []*entities.Node) *entities.Node {
+	var bestNode *entities.Node
+	var lowestScore float64
+	for idx, node := range candidates {
+		if idx == 0 {
+			bestNode = node
+			lowestScore = scores[node.Name]
+			continue
+		}
+
+		if scores[node.Name] < lowestScore {
+			bestNode = node
+			lowestScore = scores[node.Name]
+		}
+	}
+
+	return bestNode
+}
+
+// utilization returns the average fraction of the node's known cpu, memory and
+// disk capacity that would be allocated once the task is placed on it.
+func utilization(task entities.Task, node *entities.Node) float64 {
+	var total float64
+	var known int
+	if node.Cores > 0 {
+		total += (node.CPUAllocated + task.CPU) / float64(node.Cores)
+		known++
+	}
+	if node.Memory > 0 {
+		total += float64(node.MemoryAllocated+task.Memory) / float64(node.Memory)
+		known++
+	}
+	if node.Disk > 0 {
+		total += float64(node.DiskAllocated+task.Disk) / float64(node.Disk)
+		known++
+	}
+	if known == 0 {
+		return 0
+	}
+	return total / float64(known)
+}
@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"github.com/google/uuid"
+	"orc/domain/entities"
+)
+
+// Simulation describes where a task would be placed without placing it.
+// Node is empty if the task is unschedulable; Preempt lists the tasks that
+// would be stopped to make room.
+type Simulation struct {
+	TaskID   uuid.UUID
+	Node     string
+	Scores   map[string]float64
+	Rejected map[string]string
+	Preempt  []uuid.UUID
+}
+
+// stateful is implemented by schedulers and plugins whose scoring changes
+// their internal state. snapshot returns a function restoring the state.
+type stateful interface {
+	snapshot() func()
+}
+
+// Simulate runs candidate selection, scoring and picking against the nodes,
+// leaving the scheduler's state as it was.
+func Simulate(s Scheduler, task entities.Task, nodes []*entities.Node) Simulation {
+	for _, restore := range snapshots(s) {
+		defer restore()
+	}
+
+	d := Decide(s, task, nodes)
+	sim := Simulation{
+		TaskID:   task.ID,
+		Scores:   d.Scores,
+		Rejected: d.Rejected,
+	}
+	if d.Node != nil {
+		sim.Node = d.Node.Name
+		return sim
+	}
+
+	node, victims := PreemptWith(s, task, nodes)
+	if node != nil {
+		sim.Node = node.Name
+		for _, victim := range victims {
+			sim.Preempt = append(sim.Preempt, victim.ID)
+		}
+	}
+	return sim
+}
+
+func snapshots(s Scheduler) []func() {
+	var restores []func()
+	if st, ok := s.(stateful); ok {
+		restores = append(restores, st.snapshot())
+	}
+	if f, ok := s.(*Framework); ok {
+		for _, wp := range f.scores {
+			if st, ok := wp.plugin.(stateful); ok {
+				restores = append(restores, st.snapshot())
+			}
+		}
+	}
+	return restores
+}
@@ -0,0 +1,29 @@
+package scheduler
+
+import "orc/domain/entities"
+
+// spreadTaskWeight is added to a node's score for every task already running
+// on it, so task count outweighs small differences in allocation.
+const spreadTaskWeight = 0.5
+
+// Spread places tasks on the least allocated node with the fewest tasks,
+// so losing a single node affects as few tasks as possible.
+type Spread struct {
+	Name string
+}
+
+func (s *Spread) SelectCandidateNodes(task entities.Task, nodes []*entities.Node) []*entities.Node {
+	return selectCandidates(task, nodes)
+}
+
+func (s *Spread) Score(task entities.Task, nodes []*entities.Node) map[string]float64 {
+	nodeScores := make(map[string]float64)
+	for _, node := range nodes {
+		nodeScores[node.Name] = utilization(task, node) + spreadTaskWeight*float64(node.TaskCount)
+	}
+	return nodeScores
+}
+
+func (s *Spread) Pick(scores map[string]float64, candidates []*entities.Node) *entities.Node {
+	return pickLowest(scores, candidates)
+}
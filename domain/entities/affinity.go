@@ -0,0 +1,61 @@
+package entities
+
+type LabelOperator string
+
+const (
+	LabelIn           LabelOperator = "In"
+	LabelNotIn        LabelOperator = "NotIn"
+	LabelExists       LabelOperator = "Exists"
+	LabelDoesNotExist LabelOperator = "DoesNotExist"
+)
+
+type LabelRequirement struct {
+	Key      string
+	Operator LabelOperator
+	Values   []string
+}
+
+func (r LabelRequirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case LabelIn:
+		return ok && contains(r.Values, value)
+	case LabelNotIn:
+		return !ok || !contains(r.Values, value)
+	case LabelExists:
+		return ok
+	case LabelDoesNotExist:
+		return !ok
+	default:
+		return false
+	}
+}
+
+// Affinity constrains the nodes a task may run on. NodeAffinity is matched
+// against node labels, TaskAffinity and TaskAntiAffinity against the labels of
+// the tasks already placed on the node. PreferredNodeAffinity only ranks nodes.
+type Affinity struct {
+	NodeAffinity          []LabelRequirement
+	PreferredNodeAffinity []LabelRequirement
+	TaskAffinity          map[string]string
+	TaskAntiAffinity      map[string]string
+}
+
+// MatchLabels reports whether every key/value in selector is present in labels.
+func MatchLabels(selector, labels map[string]string) bool {
+	for key, value := range selector {
+		if v, ok := labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+package entities
+
+// ExecRequest runs a one-shot command in a task's container.
+type ExecRequest struct {
+	Cmd []string
+	Env []string
+}
+
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
@@ -0,0 +1,85 @@
+package entities
+
+import (
+	"strings"
+	"time"
+)
+
+type PullPolicy string
+
+const (
+	PullAlways       PullPolicy = "Always"
+	PullIfNotPresent PullPolicy = "IfNotPresent"
+	PullNever        PullPolicy = "Never"
+)
+
+// RegistryAuth holds the credentials for a private image registry.
+type RegistryAuth struct {
+	Username      string
+	Password      string
+	ServerAddress string
+	IdentityToken string
+}
+
+// Redacted returns a copy of the task without its registry password and token.
+// Only the worker pulling the image gets to see them.
+func (t *Task) Redacted() Task {
+	redacted := *t
+	if t.RegistryAuth != nil {
+		redacted.RegistryAuth = &RegistryAuth{
+			Username:      t.RegistryAuth.Username,
+			ServerAddress: t.RegistryAuth.ServerAddress,
+		}
+	}
+	return redacted
+}
+
+// RedactTasks returns copies of the tasks without registry passwords and tokens.
+func RedactTasks(tasks []Task) []Task {
+	redacted := make([]Task, 0, len(tasks))
+	for _, task := range tasks {
+		redacted = append(redacted, task.Redacted())
+	}
+	return redacted
+}
+
+// ImagePullStatus tracks the progress of pulling the task's image.
+type ImagePullStatus struct {
+	Status    string
+	Current   int64
+	Total     int64
+	Error     string
+	UpdatedAt time.Time
+}
+
+// EffectivePullPolicy returns the task's pull policy, defaulting to Always for
+// untagged and :latest images and to IfNotPresent otherwise.
+func (t *Task) EffectivePullPolicy() PullPolicy {
+	if t.PullPolicy != "" {
+		return t.PullPolicy
+	}
+	name := t.Image
+	if i := strings.Index(name, "@"); i >= 0 {
+		return PullIfNotPresent
+	}
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if !strings.Contains(name, ":") || strings.HasSuffix(name, ":latest") {
+		return PullAlways
+	}
+	return PullIfNotPresent
+}
+
+// ImageRegistry returns the registry host an image is pulled from.
+func ImageRegistry(image string) string {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return "docker.io"
+	}
+	host := image[:i]
+	if strings.ContainsAny(host, ".:") || host == "localhost" {
+		return host
+	}
+	return "docker.io"
+}
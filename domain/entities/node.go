@@ -1,15 +1,27 @@
 package entities
 
+import (
+	"github.com/google/uuid"
+	"maps"
+	"orc/pkg/xstats"
+	"slices"
+)
+
 type Node struct {
 	Name            string
 	IP              string
 	Cores           int64
+	CPUAllocated    float64
 	Memory          int64
 	MemoryAllocated int64
 	Disk            int64
 	DiskAllocated   int64
 	Role            string
 	TaskCount       int
+	Labels          map[string]string
+	Taints          []Taint
+	Tasks           map[uuid.UUID]Task
+	Stats           *xstats.Stats
 }
 
 func NewNode(name, api, role string) *Node {
@@ -17,11 +29,72 @@ func NewNode(name, api, role string) *Node {
 		Name:            name,
 		IP:              api,
 		Cores:           0,
+		CPUAllocated:    0,
 		Memory:          0,
 		MemoryAllocated: 0,
 		Disk:            0,
 		DiskAllocated:   0,
 		Role:            role,
 		TaskCount:       0,
+		Labels:          make(map[string]string),
+		Tasks:           make(map[uuid.UUID]Task),
+	}
+}
+
+// Clone returns a copy of the node that shares nothing with it except the
+// stats, which are replaced rather than modified.
+func (n *Node) Clone() *Node {
+	c := *n
+	c.Labels = maps.Clone(n.Labels)
+	c.Taints = slices.Clone(n.Taints)
+	c.Tasks = maps.Clone(n.Tasks)
+	return &c
+}
+
+// Redacted returns a clone of the node whose tasks carry no registry
+// credentials.
+func (n *Node) Redacted() *Node {
+	c := n.Clone()
+	for id, task := range c.Tasks {
+		c.Tasks[id] = task.Redacted()
+	}
+	return c
+}
+
+// FreeCores returns the number of cores not yet claimed by tasks on the node.
+func (n *Node) FreeCores() float64 {
+	return float64(n.Cores) - n.CPUAllocated
+}
+
+func (n *Node) FreeMemory() int64 {
+	return n.Memory - n.MemoryAllocated
+}
+
+func (n *Node) FreeDisk() int64 {
+	return n.Disk - n.DiskAllocated
+}
+
+// Allocate reserves the task's resources on the node, replacing any earlier
+// reservation for the same task.
+func (n *Node) Allocate(t Task) {
+	if placed, ok := n.Tasks[t.ID]; ok {
+		n.Release(placed)
+	}
+	n.CPUAllocated += t.CPU
+	n.MemoryAllocated += t.Memory
+	n.DiskAllocated += t.Disk
+	n.TaskCount++
+	n.Tasks[t.ID] = t
+}
+
+// Release returns the task's resources to the node.
+func (n *Node) Release(t Task) {
+	if _, ok := n.Tasks[t.ID]; !ok {
+		return
 	}
+	n.CPUAllocated = max(n.CPUAllocated-t.CPU, 0)
+	n.MemoryAllocated = max(n.MemoryAllocated-t.Memory, 0)
+	n.DiskAllocated = max(n.DiskAllocated-t.Disk, 0)
+	n.TaskCount = max(n.TaskCount-1, 0)
+	delete(n.Tasks, t.ID)
 }
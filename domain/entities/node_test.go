@@ -0,0 +1,30 @@
+package entities
+
+import (
+	"github.com/google/uuid"
+	"testing"
+)
+
+func TestAllocateReplacesReservation(t *testing.T) {
+	n := NewNode("a", "http://a", "worker")
+	task := Task{ID: uuid.New(), CPU: 1, Memory: 512, Disk: 100}
+
+	n.Allocate(task)
+	n.Allocate(task)
+	if n.CPUAllocated != 1 || n.MemoryAllocated != 512 || n.DiskAllocated != 100 || n.TaskCount != 1 {
+		t.Fatalf("allocated %v cpu, %d memory, %d disk, %d tasks after allocating twice",
+			n.CPUAllocated, n.MemoryAllocated, n.DiskAllocated, n.TaskCount)
+	}
+
+	task.Memory = 256
+	n.Allocate(task)
+	if n.MemoryAllocated != 256 || n.TaskCount != 1 {
+		t.Errorf("allocated %d memory, %d tasks after resizing", n.MemoryAllocated, n.TaskCount)
+	}
+
+	n.Release(task)
+	if n.CPUAllocated != 0 || n.MemoryAllocated != 0 || n.DiskAllocated != 0 || n.TaskCount != 0 {
+		t.Errorf("allocated %v cpu, %d memory, %d disk, %d tasks after release",
+			n.CPUAllocated, n.MemoryAllocated, n.DiskAllocated, n.TaskCount)
+	}
+}
@@ -8,7 +8,11 @@ type OrcConfig struct {
 	AttachStdout  bool
 	AttachStderr  bool
 	ExposedPorts  nat.PortSet
+	PortBindings  nat.PortMap
+	Entrypoint    []string
 	Cmd           []string
+	WorkingDir    string
+	Mounts        []Volume
 	Image         string
 	CPU           float64
 	Memory        int64
@@ -18,18 +22,32 @@ type OrcConfig struct {
 }
 
 func NewOrcConfig(t *Task) OrcConfig {
+	portBindings := t.HostPortBindings()
+	exposedPorts := make(nat.PortSet, len(t.ExposedPorts)+len(portBindings))
+	for port := range t.ExposedPorts {
+		exposedPorts[port] = struct{}{}
+	}
+	for port := range portBindings {
+		exposedPorts[port] = struct{}{}
+	}
+
 	return OrcConfig{
-		Name:          t.Name,
-		AttachStdin:   false,
-		AttachStdout:  false,
-		AttachStderr:  false,
-		ExposedPorts:  t.ExposedPorts,
-		Cmd:           nil,
-		Image:         t.Image,
-		CPU:           0,
-		Memory:        0,
-		Disk:          0,
-		Env:           nil,
-		RestartPolicy: "",
+		Name:         t.Name,
+		AttachStdin:  false,
+		AttachStdout: false,
+		AttachStderr: false,
+		ExposedPorts: exposedPorts,
+		PortBindings: portBindings,
+		Entrypoint:   t.Command,
+		Cmd:          t.Args,
+		WorkingDir:   t.WorkingDir,
+		Mounts:       t.Volumes,
+		Image:        t.Image,
+		CPU:          t.CPU,
+		Memory:       t.Memory,
+		Disk:         t.Disk,
+		Env:          t.Env,
+		// Restarts are handled by the manager according to the task's policy.
+		RestartPolicy: "no",
 	}
 }
@@ -0,0 +1,112 @@
+package entities
+
+import (
+	"fmt"
+	"github.com/docker/go-connections/nat"
+	"net"
+	"strconv"
+)
+
+// ParsePortBindings turns the task's PortBindings, container port to
+// "[hostIP:]hostPort", into a nat.PortMap.
+func ParsePortBindings(bindings map[string]string) (nat.PortMap, error) {
+	portMap := make(nat.PortMap, len(bindings))
+	for containerPort, hostBinding := range bindings {
+		proto, port := nat.SplitProtoPort(containerPort)
+		p, err := nat.NewPort(proto, port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid container port %q: %v", containerPort, err)
+		}
+
+		hostIP, hostPort := "", hostBinding
+		if host, portPart, err := net.SplitHostPort(hostBinding); err == nil {
+			hostIP, hostPort = host, portPart
+		}
+		if hostIP != "" && net.ParseIP(hostIP) == nil {
+			return nil, fmt.Errorf("invalid host ip %q for port %s", hostIP, containerPort)
+		}
+		if n, err := strconv.Atoi(hostPort); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid host port %q for port %s", hostPort, containerPort)
+		}
+
+		portMap[p] = append(portMap[p], nat.PortBinding{HostIP: hostIP, HostPort: hostPort})
+	}
+	return portMap, nil
+}
+
+// HostPortBindings returns the task's explicit port bindings. Exposed ports
+// without a binding get an empty host port, so they are published on a random
+// one. Invalid bindings are skipped; they are rejected when the task is
+// submitted.
+func (t *Task) HostPortBindings() nat.PortMap {
+	if len(t.PortBindings) == 0 {
+		return nil
+	}
+	portMap, err := ParsePortBindings(t.PortBindings)
+	if err != nil {
+		return nil
+	}
+	for port := range t.ExposedPorts {
+		if _, ok := portMap[port]; !ok {
+			portMap[port] = []nat.PortBinding{{}}
+		}
+	}
+	return portMap
+}
+
+// ConflictingHostPort returns the first fixed host port requested by both
+// port maps on overlapping host addresses.
+func ConflictingHostPort(a, b nat.PortMap) (string, bool) {
+	for portA, bindingsA := range a {
+		for portB, bindingsB := range b {
+			if portA.Proto() != portB.Proto() {
+				continue
+			}
+			for _, ba := range bindingsA {
+				for _, bb := range bindingsB {
+					if ba.HostPort == "" || ba.HostPort != bb.HostPort {
+						continue
+					}
+					if hostIPsOverlap(ba.HostIP, bb.HostIP) {
+						return fmt.Sprintf("%s/%s", ba.HostPort, portA.Proto()), true
+					}
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+func hostIPsOverlap(a, b string) bool {
+	isAny := func(ip string) bool {
+		return ip == "" || ip == "0.0.0.0" || ip == "::"
+	}
+	return isAny(a) || isAny(b) || a == b
+}
+
+// HostPort returns the host port the container port is published on, or the
+// first published port if containerPort is empty.
+func HostPort(ports nat.PortMap, containerPort string) (string, error) {
+	if len(ports) == 0 {
+		return "", fmt.Errorf("no ports found")
+	}
+	if containerPort != "" {
+		proto, port := nat.SplitProtoPort(containerPort)
+		p, err := nat.NewPort(proto, port)
+		if err != nil {
+			return "", fmt.Errorf("invalid port %q: %v", containerPort, err)
+		}
+		bindings := ports[p]
+		if len(bindings) == 0 {
+			return "", fmt.Errorf("port %s is not published", p)
+		}
+		return bindings[0].HostPort, nil
+	}
+	for _, bindings := range ports {
+		if len(bindings) > 0 {
+			return bindings[0].HostPort, nil
+		}
+	}
+
+	return "", fmt.Errorf("no host ports found")
+}
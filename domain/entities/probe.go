@@ -0,0 +1,94 @@
+package entities
+
+import (
+	"fmt"
+	"time"
+)
+
+type ProbeType string
+
+const (
+	ProbeHTTP ProbeType = "http"
+	ProbeTCP  ProbeType = "tcp"
+	ProbeExec ProbeType = "exec"
+	ProbeGRPC ProbeType = "grpc"
+)
+
+const (
+	defaultProbeInterval         = 10 * time.Second
+	defaultProbeTimeout          = time.Second
+	defaultProbeFailureThreshold = 3
+)
+
+// Probe checks the health of a running task. Port is the container port the
+// check connects to, e.g. "7777/tcp"; without it the first published port is
+// used. Path applies to http probes, Command to exec probes and Service to
+// grpc probes, where empty means the server's overall health.
+type Probe struct {
+	Type                ProbeType
+	Port                string
+	Path                string
+	Command             []string
+	Service             string
+	IntervalSeconds     int
+	TimeoutSeconds      int
+	FailureThreshold    int
+	InitialDelaySeconds int
+}
+
+func (p *Probe) Interval() time.Duration {
+	if p.IntervalSeconds <= 0 {
+		return defaultProbeInterval
+	}
+	return time.Duration(p.IntervalSeconds) * time.Second
+}
+
+func (p *Probe) Timeout() time.Duration {
+	if p.TimeoutSeconds <= 0 {
+		return defaultProbeTimeout
+	}
+	return time.Duration(p.TimeoutSeconds) * time.Second
+}
+
+func (p *Probe) Threshold() int {
+	if p.FailureThreshold <= 0 {
+		return defaultProbeFailureThreshold
+	}
+	return p.FailureThreshold
+}
+
+func (p *Probe) InitialDelay() time.Duration {
+	return time.Duration(p.InitialDelaySeconds) * time.Second
+}
+
+// EffectiveHealthProbe returns the task's liveness probe, which restarts the
+// task when it fails. The older HealthCheck path is treated as an http probe
+// on the first published port.
+func (t *Task) EffectiveHealthProbe() *Probe {
+	if t.HealthProbe != nil {
+		return t.HealthProbe
+	}
+	if t.HealthCheck != "" {
+		return &Probe{
+			Type:             ProbeHTTP,
+			Path:             t.HealthCheck,
+			IntervalSeconds:  30,
+			FailureThreshold: 1,
+		}
+	}
+	return nil
+}
+
+func (p *Probe) Validate() error {
+	switch p.Type {
+	case ProbeHTTP, ProbeTCP, ProbeGRPC:
+		return nil
+	case ProbeExec:
+		if len(p.Command) == 0 {
+			return fmt.Errorf("exec probe has no command")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown probe type %q", p.Type)
+	}
+}
@@ -0,0 +1,103 @@
+package entities
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+type RestartPolicyMode string
+
+const (
+	RestartAlways    RestartPolicyMode = "Always"
+	RestartOnFailure RestartPolicyMode = "OnFailure"
+	RestartNever     RestartPolicyMode = "Never"
+)
+
+const (
+	defaultMaxRestarts = 3
+	restartBackoffBase = 10 * time.Second
+	restartBackoffMax  = 5 * time.Minute
+	// restartJitter spreads restarts by up to this fraction of the backoff.
+	restartJitter = 0.2
+	// restartResetAfter is how long a task has to run before its earlier
+	// restarts are forgotten.
+	restartResetAfter = 10 * time.Minute
+)
+
+// Reasons a task's container stopped running.
+const (
+	TerminationCompleted = "Completed"
+	TerminationError     = "Error"
+	TerminationOOMKilled = "OOMKilled"
+	TerminationUnhealthy = "Unhealthy"
+	TerminationStopped   = "Stopped"
+)
+
+// ParseRestartPolicy accepts the policy names and, for compatibility, the
+// Docker restart policy names. Empty means OnFailure.
+func ParseRestartPolicy(policy string) (RestartPolicyMode, error) {
+	switch strings.ToLower(policy) {
+	case "always", "unless-stopped":
+		return RestartAlways, nil
+	case "", "onfailure", "on-failure":
+		return RestartOnFailure, nil
+	case "never", "no":
+		return RestartNever, nil
+	default:
+		return "", fmt.Errorf("unknown restart policy %q", policy)
+	}
+}
+
+func (t *Task) EffectiveRestartPolicy() RestartPolicyMode {
+	policy, err := ParseRestartPolicy(t.RestartPolicy)
+	if err != nil {
+		return RestartOnFailure
+	}
+	return policy
+}
+
+// ShouldRestart reports whether the task's restart policy asks for a task
+// that stopped running for the given reason to be started again. Tasks
+// stopped on request are never restarted.
+func (t *Task) ShouldRestart(reason string) bool {
+	if reason == TerminationStopped {
+		return false
+	}
+	policy := t.EffectiveRestartPolicy()
+	switch policy {
+	case RestartAlways:
+		return t.MaxRestarts <= 0 || t.RestartCount < t.MaxRestarts
+	case RestartOnFailure:
+		if reason == TerminationCompleted {
+			return false
+		}
+		maxRestarts := t.MaxRestarts
+		if maxRestarts <= 0 {
+			maxRestarts = defaultMaxRestarts
+		}
+		return t.RestartCount < maxRestarts
+	default:
+		return false
+	}
+}
+
+// RestartBackoff returns how long to wait before the next restart: the base
+// delay doubled for every previous restart, capped, with random jitter.
+func (t *Task) RestartBackoff() time.Duration {
+	backoff := restartBackoffMax
+	if t.RestartCount < 16 {
+		backoff = min(restartBackoffBase<<t.RestartCount, restartBackoffMax)
+	}
+	jitter := (rand.Float64()*2 - 1) * restartJitter * float64(backoff)
+	return backoff + time.Duration(jitter)
+}
+
+// RanStably reports whether the task has been running long enough since its
+// last start for its restart count to be reset, so that rare crashes of a
+// long-running task do not add up to MaxRestarts.
+func (t *Task) RanStably(now time.Time) bool {
+	return t.State == TaskRunning && t.RestartCount > 0 && t.StartsAt != nil &&
+		now.Sub(*t.StartsAt) >= restartResetAfter
+}
@@ -0,0 +1,48 @@
+package entities
+
+import (
+	"fmt"
+	"time"
+)
+
+type HookType string
+
+const (
+	HookHTTP HookType = "http"
+	HookExec HookType = "exec"
+)
+
+const defaultStopGracePeriod = 10 * time.Second
+
+// Hook is an action run against a task's container. An http hook sends a GET
+// to Path on the container's published Port, or the first published port;
+// an exec hook runs Command inside the container.
+type Hook struct {
+	Type    HookType
+	Port    string
+	Path    string
+	Command []string
+}
+
+func (h *Hook) Validate() error {
+	switch h.Type {
+	case HookHTTP:
+		return nil
+	case HookExec:
+		if len(h.Command) == 0 {
+			return fmt.Errorf("exec hook has no command")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown hook type %q", h.Type)
+	}
+}
+
+// StopGracePeriod is how long the task has to shut down, including its
+// PreStop hook, before its container is killed.
+func (t *Task) StopGracePeriod() time.Duration {
+	if t.StopGracePeriodSeconds <= 0 {
+		return defaultStopGracePeriod
+	}
+	return time.Duration(t.StopGracePeriodSeconds) * time.Second
+}
@@ -0,0 +1,70 @@
+package entities
+
+type TaintEffect string
+
+const (
+	TaintNoSchedule       TaintEffect = "NoSchedule"
+	TaintPreferNoSchedule TaintEffect = "PreferNoSchedule"
+	TaintNoExecute        TaintEffect = "NoExecute"
+)
+
+// Taint marks a node as reserved. Tasks are kept off the node unless they
+// carry a matching toleration.
+type Taint struct {
+	Key    string
+	Value  string
+	Effect TaintEffect
+}
+
+type TolerationOperator string
+
+const (
+	TolerationEqual  TolerationOperator = "Equal"
+	TolerationExists TolerationOperator = "Exists"
+)
+
+// Toleration lets a task run on nodes with a matching taint. An empty Key
+// with the Exists operator matches every taint, an empty Effect matches
+// every effect.
+type Toleration struct {
+	Key      string
+	Operator TolerationOperator
+	Value    string
+	Effect   TaintEffect
+}
+
+func (t Toleration) Tolerates(taint Taint) bool {
+	if t.Effect != "" && t.Effect != taint.Effect {
+		return false
+	}
+	switch t.Operator {
+	case TolerationExists:
+		return t.Key == "" || t.Key == taint.Key
+	case TolerationEqual, "":
+		return t.Key == taint.Key && t.Value == taint.Value
+	default:
+		return false
+	}
+}
+
+// UntoleratedTaints returns the node taints with the given effect that the
+// task does not tolerate.
+func (t *Task) UntoleratedTaints(n *Node, effect TaintEffect) []Taint {
+	var taints []Taint
+	for _, taint := range n.Taints {
+		if taint.Effect != effect {
+			continue
+		}
+		tolerated := false
+		for _, toleration := range t.Tolerations {
+			if toleration.Tolerates(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			taints = append(taints, taint)
+		}
+	}
+	return taints
+}
@@ -3,6 +3,7 @@ package entities
 import (
 	"github.com/docker/go-connections/nat"
 	"github.com/google/uuid"
+	"slices"
 	"time"
 )
 
@@ -14,16 +15,24 @@ const (
 	TaskRunning
 	TaskCompleted
 	TaskFailed = iota - 5
+	// TaskStopping is a task whose container is being shut down.
+	TaskStopping TaskState = iota
 )
 
 var taskStateTransitionMap = map[TaskState][]TaskState{
 	TaskPending:   {TaskScheduled},
 	TaskScheduled: {TaskScheduled, TaskRunning, TaskFailed},
-	TaskRunning:   {TaskRunning, TaskCompleted, TaskFailed},
+	TaskRunning:   {TaskRunning, TaskStopping, TaskCompleted, TaskFailed},
+	TaskStopping:  {TaskStopping, TaskCompleted, TaskFailed},
 	TaskCompleted: {},
 	TaskFailed:    {},
 }
 
+// taskRequeueStates are the states a task may be scheduled again from when it
+// is requeued after preemption or restarted. A running task is restarted when
+// it fails its liveness probe.
+var taskRequeueStates = []TaskState{TaskRunning, TaskCompleted, TaskFailed}
+
 func (s *TaskState) ValidateTransition(destination TaskState) bool {
 	allowed, exists := taskStateTransitionMap[*s]
 	if !exists {
@@ -37,23 +46,58 @@ func (s *TaskState) ValidateTransition(destination TaskState) bool {
 	return false
 }
 
+// ValidateRequeue reports whether a task in this state may be scheduled again
+// by a requeue or restart.
+func (s *TaskState) ValidateRequeue() bool {
+	return slices.Contains(taskRequeueStates, *s)
+}
+
 type Task struct {
 	ID            uuid.UUID
 	ContainerID   string
 	Name          string
 	State         TaskState
 	Image         string
+	ImagePull     *ImagePullStatus
+	PullPolicy    PullPolicy
+	RegistryAuth  *RegistryAuth
+	Command       []string
+	Args          []string
+	Env           []string
+	WorkingDir    string
 	CPU           float64
 	Memory        int64
 	Disk          int64
 	ExposedPorts  nat.PortSet
 	PortBindings  map[string]string
+	Volumes       []Volume
 	RestartPolicy string
-	StartsAt      *time.Time
-	FinishedAt    *time.Time
-	HealthCheck   string
-	RestartCount  int
-	HostPorts     nat.PortMap
+	// StopSignal is sent to the container to stop it, SIGTERM by default.
+	StopSignal             string
+	StopGracePeriodSeconds int
+	PreStop                *Hook
+	MaxRestarts            int
+	StartsAt               *time.Time
+	FinishedAt             *time.Time
+	HealthCheck            string
+	HealthProbe            *Probe
+	ReadinessProbe         *Probe
+	Ready                  bool
+	RestartCount           int
+	NextRestartAt          *time.Time
+	// LastTerminationReason is why the task's container last stopped running.
+	LastTerminationReason string
+	// ExitCode, OOMKilled and TerminationMessage describe how the task's
+	// container last exited.
+	ExitCode           int
+	OOMKilled          bool
+	TerminationMessage string
+	HostPorts          nat.PortMap
+	Labels             map[string]string
+	NodeSelector       map[string]string
+	Affinity           *Affinity
+	Tolerations        []Toleration
+	Priority           int
 }
 
 type TaskEvent struct {
@@ -61,4 +105,7 @@ type TaskEvent struct {
 	State       TaskState
 	RequestedAt time.Time
 	Task        Task
+	// RemoveVolumes removes the task's named volumes once it is stopped. It
+	// is only set when a user deletes the task.
+	RemoveVolumes bool
 }
@@ -0,0 +1,49 @@
+package entities
+
+import (
+	"fmt"
+	"path"
+)
+
+type VolumeType string
+
+const (
+	VolumeNamed VolumeType = "volume"
+	VolumeBind  VolumeType = "bind"
+	VolumeTmpfs VolumeType = "tmpfs"
+)
+
+// Volume mounts storage into the task's container. Source is the volume name
+// for named volumes and the host path for bind mounts; tmpfs mounts have no
+// source. Named volumes outlive the container unless the task is deleted with
+// removeVolumes.
+type Volume struct {
+	Type      VolumeType
+	Source    string
+	Target    string
+	ReadOnly  bool
+	TmpfsSize int64
+}
+
+func (v Volume) Validate() error {
+	if !path.IsAbs(v.Target) {
+		return fmt.Errorf("volume target %q must be an absolute path", v.Target)
+	}
+	switch v.Type {
+	case VolumeNamed:
+		if v.Source == "" {
+			return fmt.Errorf("named volume at %s has no name", v.Target)
+		}
+	case VolumeBind:
+		if !path.IsAbs(v.Source) {
+			return fmt.Errorf("bind mount source %q must be an absolute path", v.Source)
+		}
+	case VolumeTmpfs:
+		if v.Source != "" {
+			return fmt.Errorf("tmpfs mount at %s cannot have a source", v.Target)
+		}
+	default:
+		return fmt.Errorf("unknown volume type %q", v.Type)
+	}
+	return nil
+}
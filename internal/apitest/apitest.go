@@ -0,0 +1,74 @@
+// Package apitest holds helpers for testing the worker and manager APIs,
+// which serve tasks the same way.
+package apitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"orc/domain/entities"
+	"time"
+)
+
+// WaitForState polls GET /tasks until the task reaches the state.
+func WaitForState(url string, id uuid.UUID, state entities.TaskState) error {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(url + "/tasks")
+		if err != nil {
+			return err
+		}
+		var tasks []entities.Task
+		err = json.NewDecoder(resp.Body).Decode(&tasks)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, task := range tasks {
+			if task.ID == id && task.State == state {
+				return nil
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("task %s never reached state %v", id, state)
+}
+
+// RunAndStop starts the task through POST /tasks, waits for it to run, stops
+// it through DELETE /tasks/{taskID} and waits for it to complete.
+func RunAndStop(url string, task entities.Task) error {
+	event := entities.TaskEvent{ID: uuid.New(), State: entities.TaskRunning, Task: task}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(url+"/tasks", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("POST /tasks: status %d", resp.StatusCode)
+	}
+
+	if err := WaitForState(url, task.ID, entities.TaskRunning); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, url+"/tasks/"+task.ID.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("DELETE /tasks/%s: status %d", task.ID, resp.StatusCode)
+	}
+
+	return WaitForState(url, task.ID, entities.TaskCompleted)
+}
@@ -0,0 +1,93 @@
+package containerrt
+
+import (
+	"context"
+	"github.com/docker/go-connections/nat"
+	"io"
+	"orc/domain/entities"
+	"time"
+)
+
+// Runtime runs task containers. The worker only talks to containers through
+// it, so it can run against Docker or an in-memory fake.
+type Runtime interface {
+	ImageExists(image string) (bool, error)
+	PullImage(image string, auth *entities.RegistryAuth, progress func(PullProgress)) error
+	Run(config entities.OrcConfig) Result
+	Stop(id string, options StopOptions) Result
+	Inspect(id string) InspectResponse
+	Logs(ctx context.Context, id string, options LogsOptions, stdout, stderr io.Writer) error
+	Stats(id string) (*ContainerStats, error)
+	Exec(ctx context.Context, id string, options ExecOptions, stdin io.Reader, stdout, stderr io.Writer) (int, error)
+	CreateVolume(name string) error
+	RemoveVolume(name string) error
+}
+
+type Result struct {
+	Error       error
+	Action      string
+	ContainerID string
+	Result      string
+}
+
+type ContainerState struct {
+	Status     string
+	Running    bool
+	ExitCode   int
+	OOMKilled  bool
+	Error      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+type Container struct {
+	ID    string
+	Name  string
+	Image string
+	State ContainerState
+	Ports nat.PortMap
+}
+
+type InspectResponse struct {
+	Error     error
+	Container *Container
+}
+
+// StopOptions control how a container is stopped. Signal is sent first,
+// the image's stop signal if empty, and the container is killed if it is
+// still running after Timeout.
+type StopOptions struct {
+	Signal  string
+	Timeout time.Duration
+}
+
+// LogsOptions selects which logs to return. Tail is the number of lines from
+// the end ("all" or empty for everything), Since a timestamp or a relative
+// duration such as "10m".
+type LogsOptions struct {
+	Follow bool
+	Tail   string
+	Since  string
+}
+
+type ContainerStats struct {
+	CPUPercent  float64
+	MemoryUsage uint64
+	MemoryLimit uint64
+}
+
+// PullProgress reports the state of one layer of an image being pulled.
+type PullProgress struct {
+	Layer   string
+	Status  string
+	Current int64
+	Total   int64
+}
+
+// ExecOptions describes a command run inside a running container. With Tty
+// the output is not split and everything is written to stdout.
+type ExecOptions struct {
+	Cmd []string
+	Env []string
+	Tty bool
+}
@@ -2,97 +2,147 @@ package docker
 
 import (
 	"context"
+	"encoding/json"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/pkg/stdcopy"
 	"io"
 	"log"
 	"math"
-	"os"
+	"orc/domain/entities"
+	"orc/internal/infrastructure/containerrt"
+	"time"
 )
 
-func (d *Docker) Run() Result {
-	ctx := context.Background()
-	reader, err := d.Client.ImagePull(ctx, d.Config.Image, image.PullOptions{})
+func (d *Docker) ImageExists(name string) (bool, error) {
+	_, _, err := d.Client.ImageInspectWithRaw(context.Background(), name)
 	if err != nil {
-		log.Printf("Error pulling image %s: %v\n", d.Config.Image, err)
-		return Result{Error: err}
+		if client.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, err
 	}
-	_, err = io.Copy(os.Stdout, reader)
+	return true, nil
+}
+
+func (d *Docker) PullImage(name string, auth *entities.RegistryAuth, progress func(containerrt.PullProgress)) error {
+	options := image.PullOptions{}
+	if auth != nil {
+		encoded, err := registry.EncodeAuthConfig(registry.AuthConfig{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			ServerAddress: auth.ServerAddress,
+			IdentityToken: auth.IdentityToken,
+		})
+		if err != nil {
+			return err
+		}
+		options.RegistryAuth = encoded
+	}
+
+	reader, err := d.Client.ImagePull(context.Background(), name, options)
 	if err != nil {
-		return Result{Error: err}
+		log.Printf("Error pulling image %s: %v\n", name, err)
+		return err
 	}
+	defer reader.Close()
 
+	decoder := json.NewDecoder(reader)
+	for {
+		var msg jsonmessage.JSONMessage
+		err = decoder.Decode(&msg)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if progress == nil {
+			continue
+		}
+		p := containerrt.PullProgress{Layer: msg.ID, Status: msg.Status}
+		if msg.Progress != nil {
+			p.Current = msg.Progress.Current
+			p.Total = msg.Progress.Total
+		}
+		progress(p)
+	}
+}
+
+func (d *Docker) Run(config entities.OrcConfig) containerrt.Result {
+	ctx := context.Background()
 	restartPolicy := container.RestartPolicy{
-		Name: container.RestartPolicyMode(d.Config.RestartPolicy),
+		Name: container.RestartPolicyMode(config.RestartPolicy),
 	}
 	resources := container.Resources{
-		Memory:   d.Config.Memory,
-		NanoCPUs: int64(d.Config.CPU * math.Pow(10, 9)),
+		Memory:   config.Memory,
+		NanoCPUs: int64(config.CPU * math.Pow(10, 9)),
 	}
 
+	// config.Disk is only used for scheduling: a per-container size limit
+	// needs storage driver support most hosts do not have.
 	cc := container.Config{
-		Image:        d.Config.Image,
+		Image:        config.Image,
+		Entrypoint:   config.Entrypoint,
+		Cmd:          config.Cmd,
+		WorkingDir:   config.WorkingDir,
 		Tty:          false,
-		Env:          d.Config.Env,
-		ExposedPorts: d.Config.ExposedPorts,
+		Env:          config.Env,
+		ExposedPorts: config.ExposedPorts,
 	}
 
 	hc := container.HostConfig{
 		RestartPolicy:   restartPolicy,
 		Resources:       resources,
-		PublishAllPorts: true,
+		PortBindings:    config.PortBindings,
+		PublishAllPorts: len(config.PortBindings) == 0,
+		Mounts:          mounts(config.Mounts),
 	}
 
-	resp, err := d.Client.ContainerCreate(ctx, &cc, &hc, nil, nil, d.Config.Name)
+	resp, err := d.Client.ContainerCreate(ctx, &cc, &hc, nil, nil, config.Name)
 	if err != nil {
-		log.Printf("Error creating container %s: %v\n", d.Config.Image, err)
-		return Result{Error: err}
+		log.Printf("Error creating container %s: %v\n", config.Image, err)
+		return containerrt.Result{Error: err}
 	}
 
 	err = d.Client.ContainerStart(ctx, resp.ID, container.StartOptions{})
 	if err != nil {
-		log.Printf("Error starting container %s - %s: %v\n", d.Config.Image, resp.ID, err)
-		return Result{Error: err}
+		log.Printf("Error starting container %s - %s: %v\n", config.Image, resp.ID, err)
+		return containerrt.Result{Error: err}
 	}
 
-	result := Result{
+	result := containerrt.Result{
 		Action:      "start",
 		Error:       nil,
 		ContainerID: resp.ID,
 	}
-
-	out, err := d.Client.ContainerLogs(
-		ctx,
-		resp.ID,
-		container.LogsOptions{ShowStdout: true, ShowStderr: true},
-	)
-	if err != nil {
-		log.Printf("Error getting container logs %s: %v\n", resp.ID, err)
-		result.Error = err
-		return result
-	}
-
-	_, err = stdcopy.StdCopy(os.Stdout, os.Stderr, out)
-	if err != nil {
-		result.Error = err
-		return result
-	}
-
 	result.Result = "success"
 	return result
 }
 
-func (d *Docker) Stop(id string) Result {
+func (d *Docker) Stop(id string, options containerrt.StopOptions) containerrt.Result {
 	log.Printf("Attempting to stop container %s\n", id)
 	ctx := context.Background()
-	err := d.Client.ContainerStop(ctx, id, container.StopOptions{})
+	timeout := int(math.Ceil(options.Timeout.Seconds()))
+	err := d.Client.ContainerStop(ctx, id, container.StopOptions{
+		Signal:  options.Signal,
+		Timeout: &timeout,
+	})
 	if err != nil {
 		log.Printf("Error stopping container %s: %v\n", id, err)
-		return Result{Error: err}
+		return containerrt.Result{Error: err}
 	}
 
+	// RemoveVolumes only removes the container's anonymous volumes, named
+	// volumes are removed by the worker when the task is deleted.
 	err = d.Client.ContainerRemove(ctx, id, container.RemoveOptions{
 		RemoveVolumes: true,
 		RemoveLinks:   false,
@@ -100,10 +150,10 @@ func (d *Docker) Stop(id string) Result {
 	})
 	if err != nil {
 		log.Printf("Error removing container %s: %v\n", id, err)
-		return Result{Error: err}
+		return containerrt.Result{Error: err}
 	}
 
-	return Result{
+	return containerrt.Result{
 		Error:       nil,
 		Action:      "stop",
 		ContainerID: id,
@@ -111,15 +161,167 @@ func (d *Docker) Stop(id string) Result {
 	}
 }
 
-func (d *Docker) Inspect(containerID string) InspectResponse {
-	dc, err := client.NewClientWithOpts(client.FromEnv)
+func (d *Docker) Inspect(containerID string) containerrt.InspectResponse {
+	ctx := context.Background()
+	resp, err := d.Client.ContainerInspect(ctx, containerID)
 	if err != nil {
-		return InspectResponse{Error: err}
+		return containerrt.InspectResponse{Error: err}
 	}
-	ctx := context.Background()
-	resp, err := dc.ContainerInspect(ctx, containerID)
+
+	c := &containerrt.Container{
+		ID:    resp.ID,
+		Name:  resp.Name,
+		Image: resp.Image,
+	}
+	if resp.Config != nil {
+		c.Image = resp.Config.Image
+	}
+	if resp.State != nil {
+		c.State = containerrt.ContainerState{
+			Status:     resp.State.Status,
+			Running:    resp.State.Running,
+			ExitCode:   resp.State.ExitCode,
+			OOMKilled:  resp.State.OOMKilled,
+			Error:      resp.State.Error,
+			StartedAt:  parseTime(resp.State.StartedAt),
+			FinishedAt: parseTime(resp.State.FinishedAt),
+		}
+	}
+	if resp.NetworkSettings != nil {
+		c.Ports = resp.NetworkSettings.Ports
+	}
+	return containerrt.InspectResponse{Container: c}
+}
+
+func (d *Docker) Logs(ctx context.Context, id string, options containerrt.LogsOptions, stdout, stderr io.Writer) error {
+	out, err := d.Client.ContainerLogs(ctx, id, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     options.Follow,
+		Tail:       options.Tail,
+		Since:      options.Since,
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = stdcopy.StdCopy(stdout, stderr, out)
+	return err
+}
+
+func (d *Docker) Stats(id string) (*containerrt.ContainerStats, error) {
+	resp, err := d.Client.ContainerStatsOneShot(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var s container.StatsResponse
+	err = json.NewDecoder(resp.Body).Decode(&s)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &containerrt.ContainerStats{
+		MemoryUsage: s.MemoryStats.Usage,
+		MemoryLimit: s.MemoryStats.Limit,
+	}
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	if cpuDelta > 0 && systemDelta > 0 {
+		stats.CPUPercent = cpuDelta / systemDelta * float64(s.CPUStats.OnlineCPUs) * 100
+	}
+	return stats, nil
+}
+
+// Exec runs the command in the container and returns its exit code once it
+// finishes or ctx is done. stdin may be nil.
+func (d *Docker) Exec(ctx context.Context, id string, options containerrt.ExecOptions, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	exec, err := d.Client.ContainerExecCreate(ctx, id, container.ExecOptions{
+		Cmd:          options.Cmd,
+		Env:          options.Env,
+		Tty:          options.Tty,
+		AttachStdin:  stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	hijacked, err := d.Client.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{Tty: options.Tty})
+	if err != nil {
+		return 0, err
+	}
+	defer hijacked.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			hijacked.Close()
+		case <-done:
+		}
+	}()
+
+	if stdin != nil {
+		go func() {
+			_, _ = io.Copy(hijacked.Conn, stdin)
+			_ = hijacked.CloseWrite()
+		}()
+	}
+
+	if options.Tty {
+		_, err = io.Copy(stdout, hijacked.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, hijacked.Reader)
+	}
+	if err != nil && ctx.Err() == nil {
+		return 0, err
+	}
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	inspect, err := d.Client.ContainerExecInspect(context.Background(), exec.ID)
+	if err != nil {
+		return 0, err
+	}
+	return inspect.ExitCode, nil
+}
+
+func (d *Docker) CreateVolume(name string) error {
+	_, err := d.Client.VolumeCreate(context.Background(), volume.CreateOptions{Name: name})
+	return err
+}
+
+func (d *Docker) RemoveVolume(name string) error {
+	return d.Client.VolumeRemove(context.Background(), name, false)
+}
+
+func mounts(volumes []entities.Volume) []mount.Mount {
+	var ms []mount.Mount
+	for _, v := range volumes {
+		m := mount.Mount{
+			Type:     mount.Type(v.Type),
+			Source:   v.Source,
+			Target:   v.Target,
+			ReadOnly: v.ReadOnly,
+		}
+		if v.Type == entities.VolumeTmpfs && v.TmpfsSize > 0 {
+			m.TmpfsOptions = &mount.TmpfsOptions{SizeBytes: v.TmpfsSize}
+		}
+		ms = append(ms, m)
+	}
+	return ms
+}
+
+func parseTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
 	if err != nil {
-		return InspectResponse{Error: err}
+		return time.Time{}
 	}
-	return InspectResponse{Container: &resp}
+	return t
 }
@@ -0,0 +1,345 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"orc/domain/entities"
+	"orc/internal/infrastructure/containerrt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Behavior scripts what happens to containers started from an image.
+type Behavior struct {
+	// PullDelay blocks PullImage as a slow image pull would.
+	PullDelay time.Duration
+	// PullError makes PullImage fail.
+	PullError error
+	// RunError makes Run fail without creating a container.
+	RunError error
+	// ExitAfter makes the container exit with ExitCode once it has been
+	// running this long. Zero keeps it running until stopped.
+	ExitAfter time.Duration
+	ExitCode  int
+	OOMKilled bool
+	Stdout    string
+	Stderr    string
+	// LogsError makes Logs fail after writing Stdout and Stderr.
+	LogsError error
+	Stats     containerrt.ContainerStats
+	// Exec handles commands run in the container and returns the exit code.
+	// Without it the command line is echoed to stdout and exits with 0.
+	Exec func(cmd []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+type container struct {
+	containerrt.Container
+	behavior Behavior
+}
+
+// Runtime is an in-memory containerrt.Runtime for tests. Containers never run
+// anything; their lifecycle follows the scripted Behavior of their image.
+type Runtime struct {
+	mu         sync.Mutex
+	behaviors  map[string]Behavior
+	containers map[string]*container
+	volumes    map[string]bool
+	stops      map[string]containerrt.StopOptions
+	images     map[string]bool
+	pulls      int
+	seq        int
+	now        func() time.Time
+}
+
+func NewRuntime() *Runtime {
+	return &Runtime{
+		behaviors:  make(map[string]Behavior),
+		containers: make(map[string]*container),
+		volumes:    make(map[string]bool),
+		stops:      make(map[string]containerrt.StopOptions),
+		images:     make(map[string]bool),
+		now:        time.Now,
+	}
+}
+
+// Script sets the behavior of containers started from the image afterwards.
+func (r *Runtime) Script(image string, behavior Behavior) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.behaviors[image] = behavior
+}
+
+// Exit makes a running container exit immediately with the exit code.
+func (r *Runtime) Exit(id string, exitCode int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.containers[id]
+	if !ok {
+		return fmt.Errorf("no such container: %s", id)
+	}
+	r.finish(c, exitCode, false)
+	return nil
+}
+
+// Crash makes a running container die as if killed, optionally by the OOM killer.
+func (r *Runtime) Crash(id string, oomKilled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.containers[id]
+	if !ok {
+		return fmt.Errorf("no such container: %s", id)
+	}
+	r.finish(c, 137, oomKilled)
+	return nil
+}
+
+// Containers returns a snapshot of every container the runtime knows about.
+func (r *Runtime) Containers() []containerrt.Container {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	containers := make([]containerrt.Container, 0, len(r.containers))
+	for _, c := range r.containers {
+		r.refresh(c)
+		containers = append(containers, c.Container)
+	}
+	return containers
+}
+
+// AddImage makes the image present without pulling it.
+func (r *Runtime) AddImage(image string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.images[image] = true
+}
+
+// Stopped returns the options a container was stopped with.
+func (r *Runtime) Stopped(id string) (containerrt.StopOptions, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	options, ok := r.stops[id]
+	return options, ok
+}
+
+// Pulls returns how many times PullImage has been called.
+func (r *Runtime) Pulls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pulls
+}
+
+func (r *Runtime) ImageExists(image string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.images[image], nil
+}
+
+func (r *Runtime) PullImage(image string, _ *entities.RegistryAuth, progress func(containerrt.PullProgress)) error {
+	r.mu.Lock()
+	behavior := r.behaviors[image]
+	r.pulls++
+	r.mu.Unlock()
+
+	if progress != nil {
+		progress(containerrt.PullProgress{Layer: "fake", Status: "Downloading", Total: 100})
+	}
+	if behavior.PullDelay > 0 {
+		time.Sleep(behavior.PullDelay)
+	}
+	if behavior.PullError != nil {
+		return behavior.PullError
+	}
+	if progress != nil {
+		progress(containerrt.PullProgress{Layer: "fake", Status: "Pull complete", Current: 100, Total: 100})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.images[image] = true
+	return nil
+}
+
+func (r *Runtime) Run(config entities.OrcConfig) containerrt.Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	behavior := r.behaviors[config.Image]
+	if behavior.RunError != nil {
+		return containerrt.Result{Error: behavior.RunError}
+	}
+	if !r.images[config.Image] {
+		return containerrt.Result{Error: fmt.Errorf("no such image: %s", config.Image)}
+	}
+
+	for _, c := range r.containers {
+		if config.Name != "" && c.Name == config.Name {
+			return containerrt.Result{Error: fmt.Errorf("container name %q is already in use by container %s", config.Name, c.ID)}
+		}
+	}
+
+	for _, v := range config.Mounts {
+		if v.Type == entities.VolumeNamed {
+			r.volumes[v.Source] = true
+		}
+	}
+	r.seq++
+	id := fmt.Sprintf("fake-%d", r.seq)
+	r.containers[id] = &container{
+		Container: containerrt.Container{
+			ID:    id,
+			Name:  config.Name,
+			Image: config.Image,
+			State: containerrt.ContainerState{
+				Status:    "running",
+				Running:   true,
+				StartedAt: r.now(),
+			},
+		},
+		behavior: behavior,
+	}
+
+	return containerrt.Result{
+		Action:      "start",
+		ContainerID: id,
+		Result:      "success",
+	}
+}
+
+func (r *Runtime) Stop(id string, options containerrt.StopOptions) containerrt.Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.containers[id]; !ok {
+		return containerrt.Result{Error: fmt.Errorf("no such container: %s", id)}
+	}
+	delete(r.containers, id)
+	r.stops[id] = options
+
+	return containerrt.Result{
+		Action:      "stop",
+		ContainerID: id,
+		Result:      "success",
+	}
+}
+
+func (r *Runtime) Inspect(id string) containerrt.InspectResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.containers[id]
+	if !ok {
+		return containerrt.InspectResponse{Error: fmt.Errorf("no such container: %s", id)}
+	}
+	r.refresh(c)
+	snapshot := c.Container
+	return containerrt.InspectResponse{Container: &snapshot}
+}
+
+func (r *Runtime) Logs(ctx context.Context, id string, options containerrt.LogsOptions, stdout, stderr io.Writer) error {
+	r.mu.Lock()
+	c, ok := r.containers[id]
+	var behavior Behavior
+	if ok {
+		behavior = c.behavior
+	}
+	r.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no such container: %s", id)
+	}
+
+	if _, err := io.WriteString(stdout, behavior.Stdout); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(stderr, behavior.Stderr); err != nil {
+		return err
+	}
+	if behavior.LogsError != nil {
+		return behavior.LogsError
+	}
+	if options.Follow {
+		<-ctx.Done()
+	}
+	return nil
+}
+
+func (r *Runtime) Stats(id string) (*containerrt.ContainerStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.containers[id]
+	if !ok {
+		return nil, fmt.Errorf("no such container: %s", id)
+	}
+	stats := c.behavior.Stats
+	return &stats, nil
+}
+
+func (r *Runtime) Exec(_ context.Context, id string, options containerrt.ExecOptions, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	r.mu.Lock()
+	c, ok := r.containers[id]
+	var running bool
+	var behavior Behavior
+	if ok {
+		r.refresh(c)
+		running, behavior = c.State.Running, c.behavior
+	}
+	r.mu.Unlock()
+	if !ok {
+		return 0, fmt.Errorf("no such container: %s", id)
+	}
+	if !running {
+		return 0, fmt.Errorf("container %s is not running", id)
+	}
+
+	if behavior.Exec != nil {
+		return behavior.Exec(options.Cmd, stdin, stdout, stderr), nil
+	}
+	_, err := io.WriteString(stdout, strings.Join(options.Cmd, " ")+"\n")
+	return 0, err
+}
+
+func (r *Runtime) CreateVolume(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.volumes[name] = true
+	return nil
+}
+
+func (r *Runtime) RemoveVolume(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.volumes[name] {
+		return fmt.Errorf("no such volume: %s", name)
+	}
+	delete(r.volumes, name)
+	return nil
+}
+
+// Volumes returns the names of the volumes that currently exist.
+func (r *Runtime) Volumes() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.volumes))
+	for name := range r.volumes {
+		names = append(names, name)
+	}
+	return names
+}
+
+// refresh applies the scripted exit once its time has come.
+func (r *Runtime) refresh(c *container) {
+	if !c.State.Running || c.behavior.ExitAfter == 0 {
+		return
+	}
+	if r.now().Sub(c.State.StartedAt) >= c.behavior.ExitAfter {
+		r.finish(c, c.behavior.ExitCode, c.behavior.OOMKilled)
+	}
+}
+
+func (r *Runtime) finish(c *container, exitCode int, oomKilled bool) {
+	if !c.State.Running {
+		return
+	}
+	c.State.Status = "exited"
+	c.State.Running = false
+	c.State.ExitCode = exitCode
+	c.State.OOMKilled = oomKilled
+	c.State.FinishedAt = r.now()
+}
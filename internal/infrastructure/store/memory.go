@@ -0,0 +1,59 @@
+package store
+
+import "sync"
+
+// Memory is an in-memory Store.
+type Memory[K comparable, V any] struct {
+	mu    sync.RWMutex
+	items map[K]V
+}
+
+func NewMemory[K comparable, V any]() *Memory[K, V] {
+	return &Memory[K, V]{items: make(map[K]V)}
+}
+
+func (s *Memory[K, V]) Get(key K) (V, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.items[key]
+	return value, ok
+}
+
+func (s *Memory[K, V]) Put(key K, value V) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[key] = value
+}
+
+func (s *Memory[K, V]) Delete(key K) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, key)
+}
+
+func (s *Memory[K, V]) List() []V {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	values := make([]V, 0, len(s.items))
+	for _, value := range s.items {
+		values = append(values, value)
+	}
+	return values
+}
+
+func (s *Memory[K, V]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.items)
+}
+
+func (s *Memory[K, V]) Update(key K, fn func(value *V, ok bool) bool) (V, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.items[key]
+	if fn(&value, ok) {
+		s.items[key] = value
+		return value, true
+	}
+	return s.items[key], ok
+}
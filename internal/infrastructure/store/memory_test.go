@@ -0,0 +1,82 @@
+package store
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	s := NewMemory[string, int]()
+	s.Put("a", 1)
+	s.Put("b", 2)
+
+	if v, ok := s.Get("a"); !ok || v != 1 {
+		t.Errorf("Get(a) = %d, %v, want 1, true", v, ok)
+	}
+	if s.Len() != 2 || len(s.List()) != 2 {
+		t.Errorf("Len = %d, List has %d values, want 2", s.Len(), len(s.List()))
+	}
+
+	s.Delete("a")
+	if _, ok := s.Get("a"); ok {
+		t.Error("Get(a) found a deleted value")
+	}
+}
+
+func TestMemoryUpdate(t *testing.T) {
+	s := NewMemory[string, int]()
+
+	v, ok := s.Update("a", func(v *int, ok bool) bool {
+		*v = 10
+		return false
+	})
+	if ok || v != 0 {
+		t.Errorf("discarded Update = %d, %v, want 0, false", v, ok)
+	}
+	if s.Len() != 0 {
+		t.Error("discarded Update stored a value")
+	}
+
+	v, ok = s.Update("a", func(v *int, ok bool) bool {
+		if ok {
+			t.Error("Update found a value that was never stored")
+		}
+		*v = 10
+		return true
+	})
+	if !ok || v != 10 {
+		t.Errorf("Update = %d, %v, want 10, true", v, ok)
+	}
+
+	v, ok = s.Update("a", func(v *int, ok bool) bool {
+		*v = 20
+		return false
+	})
+	if !ok || v != 10 {
+		t.Errorf("discarded Update of a stored value = %d, %v, want 10, true", v, ok)
+	}
+}
+
+func TestMemoryConcurrentUpdate(t *testing.T) {
+	s := NewMemory[string, int]()
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				s.Update("counter", func(v *int, _ bool) bool {
+					*v++
+					return true
+				})
+				s.Get("counter")
+				s.List()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, _ := s.Get("counter"); v != 5000 {
+		t.Errorf("counter = %d, want 5000", v)
+	}
+}
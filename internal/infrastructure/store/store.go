@@ -0,0 +1,17 @@
+package store
+
+// Store holds values by key and is safe for concurrent use. Values are
+// copied in and out, so a stored value is only changed through Put or
+// Update.
+type Store[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Put(key K, value V)
+	Delete(key K)
+	List() []V
+	Len() int
+	// Update atomically reads, modifies and writes the value under key. fn
+	// gets the current value, or the zero value and false if there is none,
+	// and returns whether to store its changes. Update returns the value
+	// stored under key afterwards and whether there is one.
+	Update(key K, fn func(value *V, ok bool) bool) (V, bool)
+}
@@ -2,12 +2,16 @@ package manager
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"log"
 	"net/http"
 	"orc/domain/entities"
+	"orc/pkg/xhttp"
+	"slices"
 	"time"
 )
 
@@ -28,22 +32,38 @@ func (a *API) initRouter() {
 	a.Router.Route("/tasks", func(r chi.Router) {
 		r.Post("/", a.StartTaskHandler)
 		r.Get("/", a.GetTaskHandler)
+		r.Post("/dry-run", a.DryRunTaskHandler)
 		r.Route("/{taskID}", func(r chi.Router) {
 			r.Delete("/", a.StopTaskHandler)
+			r.Get("/logs", a.GetTaskLogsHandler)
+			r.Post("/exec", a.ExecTaskHandler)
+			r.Get("/exec/ws", a.ExecTaskWebSocketHandler)
+		})
+	})
+	a.Router.Route("/nodes", func(r chi.Router) {
+		r.Get("/", a.GetNodesHandler)
+		r.Route("/{nodeName}", func(r chi.Router) {
+			r.Put("/labels", a.SetNodeLabelsHandler)
+			r.Put("/taints", a.SetNodeTaintsHandler)
 		})
 	})
 }
 
-func (a *API) Start() error {
+// Handler returns the API's routes without starting a server for them.
+func (a *API) Handler() http.Handler {
 	a.initRouter()
-	err := http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router)
+	return a.Router
+}
+
+func (a *API) Start() error {
+	err := http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Handler())
 	return err
 }
 
 func (a *API) GetTasksHandler(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	err := json.NewEncoder(w).Encode(a.Manager.GetTasks())
+	err := json.NewEncoder(w).Encode(entities.RedactTasks(a.Manager.GetTasks()))
 	if err != nil {
 		log.Println(err)
 		return
@@ -71,8 +91,18 @@ func (a *API) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+
+	err = validateTask(taskEvent.Task)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid task: %v\n", err)
+		log.Println(msg)
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
 	a.Manager.AddTask(taskEvent)
 	log.Printf("Task added: %v\n", taskEvent.Task.ID)
+	taskEvent.Task = taskEvent.Task.Redacted()
 	w.WriteHeader(http.StatusCreated)
 	err = json.NewEncoder(w).Encode(taskEvent)
 	if err != nil {
@@ -81,10 +111,41 @@ func (a *API) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (a *API) GetTaskHandler(w http.ResponseWriter, _ *http.Request) {
+func (a *API) DryRunTaskHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	taskEvent := entities.TaskEvent{}
+	err := d.Decode(&taskEvent)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body: %v\n", err)
+		log.Println(msg)
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(a.Manager.SimulateTask(taskEvent.Task))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+}
+
+// GetTaskHandler lists the tasks; with ready=true only running tasks that
+// passed their readiness probe are returned.
+func (a *API) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
+	tasks := a.Manager.GetTasks()
+	if r.URL.Query().Get("ready") == "true" {
+		tasks = slices.DeleteFunc(tasks, func(t entities.Task) bool {
+			return t.State != entities.TaskRunning || !t.Ready
+		})
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	err := json.NewEncoder(w).Encode(a.Manager.GetTasks())
+	err := json.NewEncoder(w).Encode(entities.RedactTasks(tasks))
 	if err != nil {
 		log.Println(err)
 		return
@@ -96,31 +157,272 @@ func (a *API) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 	if taskID == "" {
 		log.Printf("Invalid task ID: %v\n", taskID)
 		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
 	tID, err := uuid.Parse(taskID)
 	if err != nil {
 		log.Printf("Invalid task ID: %v\n", taskID)
 		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
-	taskToStop, ok := a.Manager.TaskDb[tID]
+	taskToStop, ok := a.Manager.TaskDb.Get(tID)
 	if !ok {
 		log.Printf("Task not found: %v\n", tID)
 		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 
-	taskCopy := *taskToStop
+	taskCopy := taskToStop
 	taskCopy.State = entities.TaskCompleted
 
 	taskEvent := entities.TaskEvent{
-		ID:          uuid.New(),
-		State:       entities.TaskCompleted,
-		RequestedAt: time.Now(),
-		Task:        taskCopy,
+		ID:            uuid.New(),
+		State:         entities.TaskCompleted,
+		RequestedAt:   time.Now(),
+		Task:          taskCopy,
+		RemoveVolumes: r.URL.Query().Get("removeVolumes") == "true",
 	}
 	a.Manager.AddTask(taskEvent)
 
 	log.Printf("Added task %v to stop container %v\n", taskToStop.ID, taskToStop.ContainerID)
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// GetTaskLogsHandler proxies the task's logs from the worker holding it, see
+// the worker's logs endpoint for the query parameters.
+func (a *API) GetTaskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		log.Printf("Invalid task ID: %v\n", chi.URLParam(r, "taskID"))
+		writeError(w, http.StatusBadRequest, "invalid task id")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fw := xhttp.NewFlushWriter(w)
+	err = a.Manager.TaskLogs(r.Context(), tID, r.URL.RawQuery, fw)
+	if err != nil {
+		log.Printf("Error getting logs for task %v: %v\n", tID, err)
+		// Once logs have been streamed the status is sent, so the stream
+		// just ends.
+		if !fw.Written() {
+			writeError(w, taskErrorStatus(err), err.Error())
+		}
+	}
+}
+
+func (a *API) ExecTaskHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		log.Printf("Invalid task ID: %v\n", chi.URLParam(r, "taskID"))
+		writeError(w, http.StatusBadRequest, "invalid task id")
+		return
+	}
+
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	req := entities.ExecRequest{}
+	err = d.Decode(&req)
+	if err != nil || len(req.Cmd) == 0 {
+		msg := fmt.Sprintf("Error unmarshalling body: %v\n", err)
+		log.Println(msg)
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	result, err := a.Manager.ExecTask(r.Context(), tID, req)
+	if err != nil {
+		log.Printf("Error executing %v in task %v: %v\n", req.Cmd, tID, err)
+		writeError(w, taskErrorStatus(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+var upgrader = websocket.Upgrader{}
+
+// ExecTaskWebSocketHandler relays an interactive exec session between the
+// client and the worker holding the task, frame by frame.
+func (a *API) ExecTaskWebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		log.Printf("Invalid task ID: %v\n", chi.URLParam(r, "taskID"))
+		writeError(w, http.StatusBadRequest, "invalid task id")
+		return
+	}
+
+	url, err := a.Manager.ExecTaskURL(tID, r.URL.RawQuery)
+	if err != nil {
+		writeError(w, taskErrorStatus(err), err.Error())
+		return
+	}
+	workerConn, resp, err := websocket.DefaultDialer.DialContext(r.Context(), url, nil)
+	if err != nil {
+		log.Printf("Error connecting to exec of task %v: %v\n", tID, err)
+		status := http.StatusBadGateway
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	defer workerConn.Close()
+
+	clientConn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Error upgrading exec connection for task %v: %v\n", tID, err)
+		return
+	}
+	defer clientConn.Close()
+
+	done := make(chan struct{}, 2)
+	relay := func(dst, src *websocket.Conn) {
+		defer func() { done <- struct{}{} }()
+		for {
+			messageType, data, err := src.ReadMessage()
+			if err != nil {
+				if ce, ok := err.(*websocket.CloseError); ok {
+					_ = dst.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(ce.Code, ce.Text))
+				}
+				return
+			}
+			if err := dst.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}
+	go relay(workerConn, clientConn)
+	go relay(clientConn, workerConn)
+	<-done
+}
+
+func taskErrorStatus(err error) int {
+	var workerErr *WorkerError
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		return http.StatusNotFound
+	case errors.As(err, &workerErr):
+		return workerErr.StatusCode
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func (a *API) GetNodesHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	nodes := a.Manager.GetNodes()
+	for i, node := range nodes {
+		nodes[i] = node.Redacted()
+	}
+	err := json.NewEncoder(w).Encode(nodes)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+}
+
+func (a *API) SetNodeLabelsHandler(w http.ResponseWriter, r *http.Request) {
+	nodeName := chi.URLParam(r, "nodeName")
+
+	var labels map[string]string
+	err := json.NewDecoder(r.Body).Decode(&labels)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body: %v\n", err)
+		log.Println(msg)
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	err = a.Manager.SetNodeLabels(nodeName, labels)
+	if err != nil {
+		log.Println(err)
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	log.Printf("Labels of node %v set to %v\n", nodeName, labels)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) SetNodeTaintsHandler(w http.ResponseWriter, r *http.Request) {
+	nodeName := chi.URLParam(r, "nodeName")
+
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	var taints []entities.Taint
+	err := d.Decode(&taints)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body: %v\n", err)
+		log.Println(msg)
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	err = a.Manager.SetNodeTaints(nodeName, taints)
+	if err != nil {
+		log.Println(err)
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	log.Printf("Taints of node %v set to %v\n", nodeName, taints)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validateTask(t entities.Task) error {
+	_, err := entities.ParsePortBindings(t.PortBindings)
+	if err != nil {
+		return err
+	}
+	_, err = entities.ParseRestartPolicy(t.RestartPolicy)
+	if err != nil {
+		return err
+	}
+	for _, v := range t.Volumes {
+		err = v.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	for _, p := range []*entities.Probe{t.HealthProbe, t.ReadinessProbe} {
+		if p == nil {
+			continue
+		}
+		err = p.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if t.PreStop != nil {
+		err = t.PreStop.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if t.StopGracePeriodSeconds < 0 {
+		return fmt.Errorf("negative stop grace period %d", t.StopGracePeriodSeconds)
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	e := ErrResponse{
+		HTTPStatusCode: status,
+		Message:        msg,
+	}
+	err := json.NewEncoder(w).Encode(e)
+	if err != nil {
+		log.Println(err)
+	}
+}
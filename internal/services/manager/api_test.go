@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"net/http/httptest"
+	"orc/domain/core/scheduler"
+	"orc/domain/entities"
+	"orc/internal/apitest"
+	"orc/internal/infrastructure/fake"
+	"orc/internal/infrastructure/store"
+	"orc/internal/services/worker"
+	"orc/pkg/xqueue"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testResyncPeriod = 20 * time.Millisecond
+
+// startWorker serves a worker running on the fake runtime and returns its
+// address.
+func startWorker(t *testing.T) string {
+	t.Helper()
+	w := &worker.Worker{
+		Name:         "test-worker",
+		Queue:        xqueue.NewQueue[entities.TaskEvent](),
+		Db:           store.NewMemory[uuid.UUID, entities.Task](),
+		Runtime:      fake.NewRuntime(),
+		ResyncPeriod: testResyncPeriod,
+	}
+	go w.RunTasks()
+	go w.UpdateTasks()
+	srv := httptest.NewServer((&worker.API{Worker: w}).Handler())
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func TestAPIParallelTasks(t *testing.T) {
+	workers := []string{startWorker(t), startWorker(t)}
+	m := NewManager(workers, scheduler.DefaultProfiles()["roundrobin"])
+	m.ResyncPeriod = testResyncPeriod
+	go m.ProcessTasks()
+	go m.UpdateTasks()
+	go m.DoHealthChecks()
+	srv := httptest.NewServer((&API{Manager: m}).Handler())
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			task := entities.Task{
+				ID:    uuid.New(),
+				Name:  fmt.Sprintf("task-%d", i),
+				State: entities.TaskScheduled,
+				Image: "app:1.0",
+			}
+			if err := apitest.RunAndStop(srv.URL, task); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, node := range m.GetNodes() {
+		if node.TaskCount != 0 {
+			t.Errorf("node %s still counts %d tasks", node.Name, node.TaskCount)
+		}
+	}
+}
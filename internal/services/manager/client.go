@@ -2,57 +2,398 @@ package manager
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/docker/go-connections/nat"
 	"github.com/google/uuid"
+	"io"
 	"log"
 	"net/http"
+	"orc/domain/core/scheduler"
 	"orc/domain/entities"
+	"orc/pkg/xstats"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 )
 
+// SelectWorker picks the node for the task, releasing the tasks to preempt
+// from it. The scheduler may call extenders over HTTP, so it runs on a
+// snapshot of the nodes and its pick is checked against the live node.
 func (m *Manager) SelectWorker(task entities.Task) (*entities.Node, error) {
-	candidates := m.Scheduler.SelectCandidateNodes(task, m.WorkerNodes)
-	if candidates == nil {
-		return nil, fmt.Errorf("no worker nodes found for task %s", task.ID)
+	m.schedMu.Lock()
+	nodes := m.GetNodes()
+	d := scheduler.Decide(m.Scheduler, task, nodes)
+	picked, victims := d.Node, []entities.Task(nil)
+	if picked == nil {
+		picked, victims = scheduler.PreemptWith(m.Scheduler, task, nodes)
 	}
+	filters := scheduler.FiltersOf(m.Scheduler)
+	m.schedMu.Unlock()
+	if picked == nil {
+		return nil, fmt.Errorf("%w: no worker nodes can fit task %s: %s",
+			scheduler.ErrUnschedulable, task.ID, formatRejections(d.Rejected))
+	}
+
+	m.nodeMu.Lock()
+	node := m.getNode(picked.Name)
+	if node == nil || !fitsAfter(task, node, victims, filters) {
+		m.nodeMu.Unlock()
+		return nil, fmt.Errorf("node %s changed while scheduling task %s", picked.Name, task.ID)
+	}
+	for _, victim := range victims {
+		node.Release(victim)
+	}
+	m.nodeMu.Unlock()
+
+	for _, victim := range victims {
+		m.preemptTask(node.Name, victim)
+	}
+	return node, nil
+}
+
+// fitsAfter reports whether the task passes the filters on the node once the
+// victims are released, which all have to still be on it. The caller holds
+// nodeMu.
+func fitsAfter(task entities.Task, node *entities.Node, victims []entities.Task, filters []scheduler.Filter) bool {
+	sim := node.Clone()
+	for _, victim := range victims {
+		if _, ok := sim.Tasks[victim.ID]; !ok {
+			return false
+		}
+		sim.Release(victim)
+	}
+	candidates, _ := scheduler.FilterNodes(task, []*entities.Node{sim}, filters)
+	return len(candidates) > 0
+}
 
-	scores := m.Scheduler.Score(task, candidates)
-	selectedNode := m.Scheduler.Pick(scores, candidates)
+// preemptTask stops a lower priority task that has been released from the
+// node to make room and puts it back on the pending queue to be scheduled
+// elsewhere.
+func (m *Manager) preemptTask(worker string, victim entities.Task) {
+	log.Printf("Preempting task %s (priority %d) on node %s\n", victim.ID, victim.Priority, worker)
+	m.stopTask(worker, victim.ID.String(), false)
+	m.unplaceTask(worker, victim.ID)
+
+	task, _ := m.TaskDb.Update(victim.ID, func(t *entities.Task, ok bool) bool {
+		if !ok {
+			*t = victim
+		}
+		t.State = entities.TaskPending
+		t.Ready = false
+		return true
+	})
+
+	requeued := task
+	requeued.State = entities.TaskScheduled
+	m.AddTask(entities.TaskEvent{
+		ID:          uuid.New(),
+		State:       entities.TaskRunning,
+		RequestedAt: time.Now(),
+		Task:        requeued,
+	})
+}
 
-	return selectedNode, nil
+// unplaceTask forgets that the task was placed on the worker.
+func (m *Manager) unplaceTask(worker string, taskID uuid.UUID) {
+	m.TaskWorkerMap.Delete(taskID)
+	m.WorkerTaskMap.Update(worker, func(ids *[]uuid.UUID, _ bool) bool {
+		*ids = slices.DeleteFunc(slices.Clone(*ids), func(id uuid.UUID) bool {
+			return id == taskID
+		})
+		return true
+	})
 }
 
-func (m *Manager) GetTasks() []*entities.Task {
-	var tasks []*entities.Task
-	for _, task := range m.TaskDb {
-		tasks = append(tasks, task)
+func formatRejections(rejected map[string]string) string {
+	names := make([]string, 0, len(rejected))
+	for name := range rejected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	reasons := make([]string, 0, len(names))
+	for _, name := range names {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", name, rejected[name]))
 	}
-	return tasks
+	return strings.Join(reasons, "; ")
+}
+
+// SimulateTask reports where the task would be scheduled on the current nodes
+// without sending it to a worker or preempting anything.
+func (m *Manager) SimulateTask(task entities.Task) scheduler.Simulation {
+	m.schedMu.Lock()
+	defer m.schedMu.Unlock()
+	return scheduler.Simulate(m.Scheduler, task, m.GetNodes())
+}
+
+// TaskLogs streams the task's logs from the worker running it. query is passed
+// on to the worker's logs endpoint unchanged.
+func (m *Manager) TaskLogs(ctx context.Context, id uuid.UUID, query string, out io.Writer) error {
+	worker, ok := m.TaskWorkerMap.Get(id)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, id)
+	}
+
+	url := fmt.Sprintf("http://%s/tasks/%s/logs", worker, id)
+	if query != "" {
+		url += "?" + query
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating logs request for task %s: %v", id, err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error connecting to %v: %v", worker, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &WorkerError{Worker: worker, StatusCode: resp.StatusCode}
+	}
+
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
+
+// ExecTask runs a one-shot command in the task's container on the worker
+// holding it.
+func (m *Manager) ExecTask(ctx context.Context, id uuid.UUID, req entities.ExecRequest) (*entities.ExecResult, error) {
+	worker, ok := m.TaskWorkerMap.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, id)
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal exec request: %v", err)
+	}
+	url := fmt.Sprintf("http://%s/tasks/%s/exec", worker, id)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("error creating exec request for task %s: %v", id, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %v: %v", worker, err)
+	}
+	defer resp.Body.Close()
+
+	d := json.NewDecoder(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		e := ErrResponse{}
+		_ = d.Decode(&e)
+		return nil, &WorkerError{Worker: worker, StatusCode: resp.StatusCode, Message: e.Message}
+	}
+
+	result := entities.ExecResult{}
+	err = d.Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding exec response: %v", err)
+	}
+	return &result, nil
+}
+
+// ExecTaskURL returns the WebSocket URL of the interactive exec endpoint on
+// the worker holding the task.
+func (m *Manager) ExecTaskURL(id uuid.UUID, query string) (string, error) {
+	worker, ok := m.TaskWorkerMap.Get(id)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrTaskNotFound, id)
+	}
+	url := fmt.Sprintf("ws://%s/tasks/%s/exec/ws", worker, id)
+	if query != "" {
+		url += "?" + query
+	}
+	return url, nil
+}
+
+// GetNodes returns copies of the worker nodes.
+func (m *Manager) GetNodes() []*entities.Node {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	nodes := make([]*entities.Node, 0, len(m.WorkerNodes))
+	for _, node := range m.WorkerNodes {
+		nodes = append(nodes, node.Clone())
+	}
+	return nodes
+}
+
+func (m *Manager) SetNodeLabels(name string, labels map[string]string) error {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	node := m.getNode(name)
+	if node == nil {
+		return fmt.Errorf("node %s not found", name)
+	}
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	node.Labels = labels
+	m.workAdded.Notify()
+	return nil
+}
+
+func (m *Manager) SetNodeTaints(name string, taints []entities.Taint) error {
+	m.nodeMu.Lock()
+	node := m.getNode(name)
+	if node == nil {
+		m.nodeMu.Unlock()
+		return fmt.Errorf("node %s not found", name)
+	}
+	node.Taints = taints
+	evicted := m.untolerated(node)
+	m.nodeMu.Unlock()
+	m.workAdded.Notify()
+
+	for _, id := range evicted {
+		m.stopTask(name, id.String(), false)
+	}
+	return nil
+}
+
+// untolerated returns the tasks on the node that do not tolerate one of its
+// NoExecute taints and have to be evicted. The caller holds nodeMu.
+func (m *Manager) untolerated(node *entities.Node) []uuid.UUID {
+	var evicted []uuid.UUID
+	for id, placed := range node.Tasks {
+		taints := placed.UntoleratedTaints(node, entities.TaintNoExecute)
+		if len(taints) == 0 {
+			continue
+		}
+		task, ok := m.TaskDb.Get(id)
+		if !ok || isTerminal(task.State) {
+			continue
+		}
+		log.Printf("Evicting task %s from node %s: untolerated taint %s=%s:%s\n",
+			id, node.Name, taints[0].Key, taints[0].Value, taints[0].Effect)
+		evicted = append(evicted, id)
+	}
+	return evicted
+}
+
+func (m *Manager) getNodeStats(node *entities.Node) (*xstats.Stats, error) {
+	url := fmt.Sprintf("%s/stats", node.IP)
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %v: %v", node.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error retrieving stats from %v: status %d", node.Name, resp.StatusCode)
+	}
+
+	var stats xstats.Stats
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding stats from %v: %v", node.Name, err)
+	}
+	return &stats, nil
+}
+
+func (m *Manager) updateNodeStats() {
+	for _, node := range m.WorkerNodes {
+		// A node's name and address never change, so the stats are fetched
+		// without holding nodeMu.
+		stats, err := m.getNodeStats(node)
+		if err != nil {
+			log.Printf("Error getting stats for node %v: %v\n", node.Name, err)
+			continue
+		}
+
+		m.nodeMu.Lock()
+		cores, memory, disk := node.Cores, node.Memory, node.Disk
+		node.Stats = stats
+		if stats.Cores > 0 {
+			node.Cores = int64(stats.Cores)
+		}
+		if stats.MemStats != nil {
+			node.Memory = int64(stats.MemTotalKb()) * 1024
+		}
+		if stats.DiskStats != nil {
+			node.Disk = int64(stats.DiskTotal())
+		}
+		resized := node.Cores != cores || node.Memory != memory || node.Disk != disk
+		m.nodeMu.Unlock()
+		if resized {
+			m.workAdded.Notify()
+		}
+	}
+}
+
+func (m *Manager) UpdateNodeStats() {
+	for {
+		log.Println("Collecting stats from worker nodes")
+		m.updateNodeStats()
+		time.Sleep(m.resyncPeriod())
+	}
+}
+
+func (m *Manager) getNode(name string) *entities.Node {
+	for _, node := range m.WorkerNodes {
+		if node.Name == name {
+			return node
+		}
+	}
+	return nil
+}
+
+// sameTime reports whether a and b are both unset or the same instant.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func isTerminal(state entities.TaskState) bool {
+	return state == entities.TaskCompleted || state == entities.TaskFailed
+}
+
+func (m *Manager) GetTasks() []entities.Task {
+	return m.TaskDb.List()
 }
 
 func (m *Manager) UpdateTasks() {
-	time.Sleep(10 * time.Second)
 	for {
 		log.Println("Checking for task updates from workers")
 		m.updateTasks()
 		log.Println("Task updates completed")
-		time.Sleep(15 * time.Second)
+		time.Sleep(m.resyncPeriod())
 	}
 }
 
+// ProcessTasks sends pending tasks to workers as soon as they are added.
+// Tasks that cannot be scheduled are retried when a node's capacity,
+// labels or taints change, or after the resync period.
 func (m *Manager) ProcessTasks() {
 	for {
 		log.Println("Processing any tasks in the queue")
-		m.SendWork()
-		time.Sleep(10 * time.Second)
+		// Each pending event is tried once per pass; unschedulable events
+		// go back on the queue without waking the loop again.
+		for n := m.Pending.Len(); n > 0; n-- {
+			m.SendWork()
+		}
+		m.workAdded.Wait(m.resyncPeriod())
 	}
 }
 
 func (m *Manager) AddTask(taskEvent entities.TaskEvent) {
 	m.Pending.Enqueue(taskEvent)
+	m.workAdded.Notify()
+}
+
+func (m *Manager) resyncPeriod() time.Duration {
+	if m.ResyncPeriod <= 0 {
+		return defaultResyncPeriod
+	}
+	return m.ResyncPeriod
 }
 
 func (m *Manager) updateTasks() {
@@ -62,14 +403,16 @@ func (m *Manager) updateTasks() {
 		resp, err := http.Get(url)
 		if err != nil {
 			log.Printf("Error connecting to %v: %v\n", worker, err)
+			continue
 		}
 
 		if resp.StatusCode != http.StatusOK {
 			log.Printf("Error sending request: %v\n", err)
+			continue
 		}
 
 		d := json.NewDecoder(resp.Body)
-		var tasks []*entities.Task
+		var tasks []entities.Task
 		err = d.Decode(&tasks)
 		if err != nil {
 			log.Printf("Error unmarshalling tasks: %s\n", err.Error())
@@ -78,40 +421,150 @@ func (m *Manager) updateTasks() {
 		for _, task := range tasks {
 			log.Printf("Attempting to update task %v\n", task.ID)
 
-			_, ok := m.TaskDb[task.ID]
+			if w, _ := m.TaskWorkerMap.Get(task.ID); w != worker {
+				continue
+			}
+
+			stopReason, stoppedByManager := m.stopReasons.Get(task.ID)
+			var finished *entities.Task
+			changed, stale := false, false
+			_, ok := m.TaskDb.Update(task.ID, func(persisted *entities.Task, ok bool) bool {
+				if !ok {
+					return false
+				}
+				// Until the worker starts a restarted task it reports the
+				// run before the restart, which started at the same time.
+				if persisted.State == entities.TaskScheduled && sameTime(persisted.StartsAt, task.StartsAt) {
+					stale = true
+					return false
+				}
+				if !isTerminal(persisted.State) && isTerminal(task.State) {
+					released := *persisted
+					finished = &released
+				}
+				if persisted.State != task.State {
+					changed = true
+				}
+
+				// Readiness, restarts and the reason for stopping a task are
+				// tracked by the manager, workers do not report them.
+				// Workers report tasks without their registry credentials.
+				task.Ready = persisted.Ready && task.State == entities.TaskRunning
+				if task.State != entities.TaskRunning {
+					task.NextRestartAt = persisted.NextRestartAt
+				}
+				task.RestartCount = persisted.RestartCount
+				task.RegistryAuth = persisted.RegistryAuth
+				if stoppedByManager {
+					task.LastTerminationReason = stopReason
+				}
+				*persisted = task
+				return true
+			})
 			if !ok {
 				log.Printf("Task with ID %s not found\n", task.ID)
-				return
+				continue
+			}
+			if stale {
+				log.Printf("Task %s has not restarted yet, ignoring its previous run\n", task.ID)
+				continue
 			}
 
-			m.TaskDb[task.ID] = task
+			if stoppedByManager && isTerminal(task.State) {
+				m.stopReasons.Delete(task.ID)
+			}
+			if changed {
+				m.tasksChanged.Notify()
+			}
+			if finished != nil {
+				m.nodeMu.Lock()
+				if node := m.getNode(worker); node != nil {
+					node.Release(*finished)
+				}
+				m.nodeMu.Unlock()
+				// Pending tasks may fit in the released resources.
+				m.workAdded.Notify()
+			}
 		}
 	}
 }
 
+// stopTaskEvent applies a request to stop a task. A running task is stopped
+// on its worker and a task that is not placed on a worker is cancelled. A
+// task still starting on its worker is stopped once it runs.
+func (m *Manager) stopTaskEvent(taskEvent entities.TaskEvent) {
+	id := taskEvent.Task.ID
+	worker, placed := m.TaskWorkerMap.Get(id)
+	persisted, ok := m.TaskDb.Get(id)
+	switch {
+	case !ok || isTerminal(persisted.State) || persisted.State == entities.TaskStopping:
+		log.Printf("Task %s is not running, nothing to stop\n", id)
+	case !placed:
+		m.cancelTask(id)
+	case persisted.State == entities.TaskRunning:
+		m.stopTask(worker, id.String(), taskEvent.RemoveVolumes)
+		m.TaskDb.Update(id, func(t *entities.Task, ok bool) bool {
+			if !ok || t.State != entities.TaskRunning {
+				return false
+			}
+			t.State = entities.TaskStopping
+			t.Ready = false
+			return true
+		})
+	default:
+		m.Pending.Enqueue(taskEvent)
+	}
+}
+
+// cancelTask completes a task that was never placed on a worker and drops
+// its pending start events, so it is not placed once capacity frees up.
+func (m *Manager) cancelTask(id uuid.UUID) {
+	dropped := m.Pending.DeleteFunc(func(e entities.TaskEvent) bool {
+		return e.Task.ID == id
+	})
+	now := time.Now()
+	m.TaskDb.Update(id, func(t *entities.Task, ok bool) bool {
+		if !ok || isTerminal(t.State) {
+			return false
+		}
+		t.State = entities.TaskCompleted
+		t.LastTerminationReason = entities.TerminationStopped
+		t.FinishedAt = &now
+		t.Ready = false
+		return true
+	})
+	log.Printf("Cancelled task %s before it was placed, dropped %d pending events\n", id, dropped)
+	m.tasksChanged.Notify()
+}
+
 func (m *Manager) SendWork() {
 	if m.Pending.Len() > 0 {
-		event := m.Pending.Dequeue()
-		taskEvent := event.(entities.TaskEvent)
+		taskEvent, _ := m.Pending.Dequeue()
 		task := taskEvent.Task
 		log.Printf("Pulled %v off pending queue\n", task)
 
+		if taskEvent.State == entities.TaskCompleted {
+			m.stopTaskEvent(taskEvent)
+			return
+		}
+
 		task.State = entities.TaskScheduled
 		worker, err := m.SelectWorker(task)
 		if err != nil {
 			log.Printf("Error selecting worker for task %s: %v\n", task.ID, err)
-		}
-		taskWorker, ok := m.TaskWorkerMap[task.ID]
-		if ok {
-			persistedTask := m.TaskDb[task.ID]
-			if taskEvent.State == entities.TaskCompleted && persistedTask.State.ValidateTransition(taskEvent.State) {
-				m.stopTask(taskWorker, taskEvent.Task.ID.String())
-				return
-			}
-
+			m.TaskDb.Update(task.ID, func(t *entities.Task, exists bool) bool {
+				if exists {
+					return false
+				}
+				*t = taskEvent.Task
+				t.State = entities.TaskPending
+				return true
+			})
+			m.Pending.Enqueue(taskEvent)
+			return
 		}
 
-		m.TaskDb[task.ID] = &task
+		m.TaskDb.Put(task.ID, task)
 
 		data, err := json.Marshal(taskEvent)
 		if err != nil {
@@ -121,8 +574,9 @@ func (m *Manager) SendWork() {
 		url := fmt.Sprintf("http://%s/tasks", worker.Name)
 		resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
 		if err != nil {
-			log.Printf("Error connecting to %v: %v\n", worker, err)
+			log.Printf("Error connecting to %v: %v\n", worker.Name, err)
 			m.Pending.Enqueue(taskEvent)
+			return
 		}
 		d := json.NewDecoder(resp.Body)
 		if resp.StatusCode != http.StatusCreated {
@@ -144,85 +598,51 @@ func (m *Manager) SendWork() {
 		}
 		log.Printf("Received task event: %v\n", taskEvent.ID)
 
-		m.EventDb[taskEvent.ID] = &taskEvent
-		m.WorkerTaskMap[worker.Name] = append(m.WorkerTaskMap[worker.Name], task.ID)
-		m.TaskWorkerMap[task.ID] = worker.Name
+		m.EventDb.Put(taskEvent.ID, taskEvent)
+		m.WorkerTaskMap.Update(worker.Name, func(ids *[]uuid.UUID, _ bool) bool {
+			*ids = append(slices.Clone(*ids), task.ID)
+			return true
+		})
+		m.TaskWorkerMap.Put(task.ID, worker.Name)
+		m.nodeMu.Lock()
+		worker.Allocate(task)
+		m.nodeMu.Unlock()
 	} else {
 		log.Println("No work in the queue")
 	}
 }
 
-func getHostPort(ports nat.PortMap) (string, error) {
-	if len(ports) == 0 {
-		return "", fmt.Errorf("no ports found")
-	}
-	for _, bindings := range ports {
-		if len(bindings) > 0 {
-			return bindings[0].HostPort, nil
+// restartTask sends the task to its worker again, unless it has changed
+// state or been restarted since it was read.
+func (m *Manager) restartTask(task entities.Task) {
+	worker, _ := m.TaskWorkerMap.Get(task.ID)
+	restarted := false
+	updated, _ := m.TaskDb.Update(task.ID, func(t *entities.Task, ok bool) bool {
+		if !ok || t.State != task.State || t.RestartCount != task.RestartCount {
+			return false
 		}
+		t.State = entities.TaskScheduled
+		t.RestartCount++
+		t.NextRestartAt = nil
+		restarted = true
+		return true
+	})
+	if !restarted {
+		return
 	}
-
-	return "", fmt.Errorf("no host ports found")
-}
-
-func (m *Manager) checkTaskHealth(task entities.Task) error {
-	w := m.TaskWorkerMap[task.ID]
-	hostPort, err := getHostPort(task.HostPorts)
-	if err != nil {
-		return fmt.Errorf("task %s has no exposed ports: %v", task.ID, err)
-	}
-
-	worker := strings.Split(w, ":")
-	if len(worker) != 2 {
-		return fmt.Errorf("invalid worker address format: %s", w)
-	}
-
-	url := fmt.Sprintf("http://%s:%s%s", worker[0], hostPort, task.HealthCheck)
-
-	log.Printf("Calling health check for task %s: %s\n", task.ID, url)
-	resp, err := http.Get(url)
-	if err != nil {
-		msg := fmt.Sprintf("Error connecting to health check %s: %v\n", url, err)
-		log.Printf(msg)
-		return fmt.Errorf(msg)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		msg := fmt.Sprintf("Error health chech status code for task %s\n", task.ID)
-		log.Printf(msg)
-		return fmt.Errorf(msg)
-	}
-	log.Printf("Health check for task %s\n", task.ID)
-
-	return nil
-}
-
-func (m *Manager) doHealthCheck() {
-	for _, task := range m.GetTasks() {
-		if task.State == entities.TaskRunning && task.RestartCount < 3 {
-			err := m.checkTaskHealth(*task)
-			if err != nil {
-				if task.RestartCount < 3 {
-					m.restartTask(task)
-				}
-			}
-		} else if task.State == entities.TaskFailed && task.RestartCount < 3 {
-			m.restartTask(task)
+	if isTerminal(task.State) {
+		m.nodeMu.Lock()
+		if node := m.getNode(worker); node != nil {
+			node.Allocate(updated)
 		}
+		m.nodeMu.Unlock()
 	}
-}
-
-func (m *Manager) restartTask(task *entities.Task) {
-	worker := m.TaskWorkerMap[task.ID]
-	task.State = entities.TaskScheduled
-	task.RestartCount++
-	m.TaskDb[task.ID] = task
 
 	taskEvent := entities.TaskEvent{
 		ID:          uuid.New(),
 		State:       entities.TaskRunning,
 		RequestedAt: time.Now(),
-		Task:        *task,
+		Task:        updated,
 	}
 	data, err := json.Marshal(taskEvent)
 	if err != nil {
@@ -234,7 +654,14 @@ func (m *Manager) restartTask(task *entities.Task) {
 	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
 	if err != nil {
 		log.Printf("Error connecting to %v: %v\n", worker, err)
-		m.Pending.Enqueue(taskEvent)
+		// The task is placed again, possibly on another worker.
+		m.nodeMu.Lock()
+		if node := m.getNode(worker); node != nil {
+			node.Release(updated)
+		}
+		m.nodeMu.Unlock()
+		m.unplaceTask(worker, task.ID)
+		m.AddTask(taskEvent)
 		return
 	}
 
@@ -259,17 +686,12 @@ func (m *Manager) restartTask(task *entities.Task) {
 	log.Printf("Received task: %v\n", newTask)
 }
 
-func (m *Manager) DoHealthChecks() {
-	for {
-		log.Println("Performing health checks")
-		m.doHealthCheck()
-		time.Sleep(30 * time.Second)
-	}
-}
-
-func (m *Manager) stopTask(worker string, taskID string) {
-	client := &http.Client{}
+func (m *Manager) stopTask(worker string, taskID string, removeVolumes bool) {
+	client := &http.Client{Timeout: stopTaskTimeout}
 	url := fmt.Sprintf("http://%s/tasks/%s", worker, taskID)
+	if removeVolumes {
+		url += "?removeVolumes=true"
+	}
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
 		log.Printf("error creating request to delete task %s: %v\n", taskID, err)
@@ -281,8 +703,9 @@ func (m *Manager) stopTask(worker string, taskID string) {
 		log.Printf("error deleting task %s: %v\n", taskID, err)
 		return
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusNoContent {
-		log.Printf("error sending request: %v\n", err)
+		log.Printf("error deleting task %s: worker %s returned status %d\n", taskID, worker, resp.StatusCode)
 		return
 	}
 	log.Printf("task %s has been scheduled to be stopped\n", taskID)
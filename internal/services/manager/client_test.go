@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"orc/domain/core/scheduler"
+	"orc/domain/entities"
+	"testing"
+	"time"
+)
+
+func TestStopUnplacedTask(t *testing.T) {
+	m := NewManager(nil, scheduler.DefaultProfiles()["roundrobin"])
+	task := entities.Task{ID: uuid.New(), Name: "pending", State: entities.TaskPending}
+
+	m.AddTask(entities.TaskEvent{ID: uuid.New(), State: entities.TaskScheduled, RequestedAt: time.Now(), Task: task})
+	m.SendWork()
+	if got, _ := m.TaskDb.Get(task.ID); got.State != entities.TaskPending {
+		t.Fatalf("state = %v, want %v", got.State, entities.TaskPending)
+	}
+	if m.Pending.Len() != 1 {
+		t.Fatalf("pending events = %d, want 1", m.Pending.Len())
+	}
+
+	stop := task
+	stop.State = entities.TaskCompleted
+	m.AddTask(entities.TaskEvent{ID: uuid.New(), State: entities.TaskCompleted, RequestedAt: time.Now(), Task: stop})
+	for i := 0; i < 2 && m.Pending.Len() > 0; i++ {
+		m.SendWork()
+	}
+
+	if m.Pending.Len() != 0 {
+		t.Errorf("pending events = %d, want 0", m.Pending.Len())
+	}
+	got, _ := m.TaskDb.Get(task.ID)
+	if got.State != entities.TaskCompleted {
+		t.Errorf("state = %v, want %v", got.State, entities.TaskCompleted)
+	}
+	if got.LastTerminationReason != entities.TerminationStopped {
+		t.Errorf("termination reason = %q, want %q", got.LastTerminationReason, entities.TerminationStopped)
+	}
+	if _, ok := m.TaskWorkerMap.Get(task.ID); ok {
+		t.Error("cancelled task was placed on a worker")
+	}
+}
+
+// blockingExtender returns a profile whose extender accepts every node once
+// release is closed, closing arrived when it is called.
+func blockingExtender(t *testing.T, arrived, release chan struct{}) scheduler.Profile {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		close(arrived)
+		<-release
+		json.NewEncoder(w).Encode(scheduler.ExtenderResult{})
+	}))
+	t.Cleanup(srv.Close)
+	return scheduler.Profile{
+		Name:      "extended",
+		Filters:   []string{"resources"},
+		Scores:    []scheduler.WeightedScore{{Name: "binpack", Weight: 1}},
+		Extenders: []scheduler.ExtenderConfig{{URL: srv.URL, TimeoutMs: 5000}},
+	}
+}
+
+func TestSelectWorkerExtenderWithoutNodeLock(t *testing.T) {
+	arrived, release := make(chan struct{}), make(chan struct{})
+	m := NewManager([]string{"w1"}, blockingExtender(t, arrived, release))
+	m.WorkerNodes[0].Memory = 1024
+
+	type result struct {
+		node *entities.Node
+		err  error
+	}
+	done := make(chan result, 1)
+	task := entities.Task{ID: uuid.New(), Name: "t", Memory: 512}
+	go func() {
+		node, err := m.SelectWorker(task)
+		done <- result{node, err}
+	}()
+	<-arrived
+
+	nodes := make(chan []*entities.Node, 1)
+	go func() { nodes <- m.GetNodes() }()
+	select {
+	case <-nodes:
+	case <-time.After(time.Second):
+		t.Fatal("nodes locked while the extender was called")
+	}
+	close(release)
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("SelectWorker: %v", res.err)
+	}
+	if res.node != m.WorkerNodes[0] {
+		t.Errorf("picked %p, want the live node %p", res.node, m.WorkerNodes[0])
+	}
+}
+
+func TestSelectWorkerRevalidates(t *testing.T) {
+	arrived, release := make(chan struct{}), make(chan struct{})
+	m := NewManager([]string{"w1"}, blockingExtender(t, arrived, release))
+	m.WorkerNodes[0].Memory = 1024
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.SelectWorker(entities.Task{ID: uuid.New(), Name: "t", Memory: 512})
+		done <- err
+	}()
+	<-arrived
+	m.nodeMu.Lock()
+	m.WorkerNodes[0].Allocate(entities.Task{ID: uuid.New(), Name: "other", Memory: 1024})
+	m.nodeMu.Unlock()
+	close(release)
+
+	if err := <-done; err == nil {
+		t.Fatal("placed the task on a node that filled up while scheduling")
+	}
+}
@@ -0,0 +1,335 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"orc/domain/entities"
+	"orc/internal/infrastructure/probe"
+	"strings"
+	"time"
+)
+
+// healthState tracks when a running task is due for its next probe and how
+// many probes in a row have failed.
+type healthState struct {
+	nextCheck time.Time
+	failures  int
+	// probing is set while a probe runs, so a slow probe is not started
+	// again before it has returned.
+	probing bool
+}
+
+// probeResult is the outcome of a probe, reported back to the health check
+// loop by the goroutine that ran it.
+type probeResult struct {
+	task     entities.Task
+	probe    *entities.Probe
+	state    *healthState
+	liveness bool
+	err      error
+}
+
+func (m *Manager) checkTaskHealth(task entities.Task, p *entities.Probe) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout())
+	defer cancel()
+
+	if p.Type == entities.ProbeExec {
+		result, err := m.ExecTask(ctx, task.ID, entities.ExecRequest{Cmd: p.Command})
+		if err != nil {
+			return err
+		}
+		if result.ExitCode != 0 {
+			return fmt.Errorf("command %v exited with %d: %s", p.Command, result.ExitCode, result.Stderr)
+		}
+		return nil
+	}
+
+	w, _ := m.TaskWorkerMap.Get(task.ID)
+	worker := strings.Split(w, ":")
+	if len(worker) != 2 {
+		return fmt.Errorf("invalid worker address format: %s", w)
+	}
+	hostPort, err := entities.HostPort(task.HostPorts, p.Port)
+	if err != nil {
+		return fmt.Errorf("task %s has no exposed ports: %v", task.ID, err)
+	}
+
+	log.Printf("Calling %s health check for task %s on %s:%s\n", p.Type, task.ID, worker[0], hostPort)
+	switch p.Type {
+	case entities.ProbeHTTP:
+		return probe.HTTP(ctx, worker[0], hostPort, p.Path)
+	case entities.ProbeTCP:
+		return probe.TCP(ctx, worker[0], hostPort)
+	case entities.ProbeGRPC:
+		return probe.GRPC(ctx, worker[0], hostPort, p.Service)
+	default:
+		return fmt.Errorf("unknown probe type %q", p.Type)
+	}
+}
+
+// due returns the probe state of the task if the probe should run now,
+// creating it on the first call, or nil if it is not due yet or still
+// running.
+func due(states map[uuid.UUID]*healthState, task *entities.Task, p *entities.Probe, now time.Time) *healthState {
+	state, ok := states[task.ID]
+	if !ok {
+		started := now
+		if task.StartsAt != nil {
+			started = *task.StartsAt
+		}
+		state = &healthState{nextCheck: started.Add(p.InitialDelay())}
+		states[task.ID] = state
+	}
+	if state.probing || now.Before(state.nextCheck) {
+		return nil
+	}
+	state.nextCheck = now.Add(p.Interval())
+	return state
+}
+
+// startProbe runs the probe in its own goroutine, so a slow probe does not
+// hold up the probes of other tasks, and queues the result for the health
+// check loop.
+func (m *Manager) startProbe(task entities.Task, p *entities.Probe, state *healthState, liveness bool) {
+	state.probing = true
+	go func() {
+		err := m.checkTaskHealth(task, p)
+		m.probeResults.Enqueue(probeResult{task: task, probe: p, state: state, liveness: liveness, err: err})
+		m.tasksChanged.Notify()
+	}()
+}
+
+// applyProbeResults applies the results of the probes that have finished.
+// Results for tasks that stopped or restarted while they were probed are
+// dropped.
+func (m *Manager) applyProbeResults() {
+	for {
+		r, ok := m.probeResults.Dequeue()
+		if !ok {
+			return
+		}
+		r.state.probing = false
+
+		states := m.readiness
+		if r.liveness {
+			states = m.health
+		}
+		if states[r.task.ID] != r.state {
+			continue
+		}
+		task, ok := m.TaskDb.Get(r.task.ID)
+		if !ok || task.State != entities.TaskRunning || task.RestartCount != r.task.RestartCount {
+			continue
+		}
+
+		if r.liveness {
+			m.livenessResult(task, r.probe, r.state, r.err)
+		} else {
+			m.readinessResult(task, r.probe, r.state, r.err)
+		}
+	}
+}
+
+// checkLiveness starts the task's liveness probe when it is due.
+func (m *Manager) checkLiveness(task entities.Task, now time.Time) {
+	p := task.EffectiveHealthProbe()
+	if p == nil {
+		delete(m.health, task.ID)
+		return
+	}
+	if state := due(m.health, &task, p, now); state != nil {
+		m.startProbe(task, p, state, true)
+	}
+}
+
+// livenessResult stops the task once its liveness probe has failed
+// FailureThreshold times in a row. Once it has stopped, scheduleRestart
+// restarts it after its backoff if its restart policy asks for it.
+func (m *Manager) livenessResult(task entities.Task, p *entities.Probe, state *healthState, err error) {
+	if err == nil {
+		state.failures = 0
+		return
+	}
+	state.failures++
+	log.Printf("Liveness check %d/%d for task %s failed: %v\n", state.failures, p.Threshold(), task.ID, err)
+	if state.failures < p.Threshold() {
+		return
+	}
+
+	m.forgetProbes(task.ID)
+	task.LastTerminationReason = entities.TerminationUnhealthy
+	m.TaskDb.Update(task.ID, func(t *entities.Task, ok bool) bool {
+		if !ok || t.State != entities.TaskRunning {
+			return false
+		}
+		t.LastTerminationReason = entities.TerminationUnhealthy
+		return true
+	})
+	log.Printf("Stopping unhealthy task %s, restart policy is %s\n", task.ID, task.EffectiveRestartPolicy())
+	m.stopReasons.Put(task.ID, entities.TerminationUnhealthy)
+	worker, _ := m.TaskWorkerMap.Get(task.ID)
+	m.stopTask(worker, task.ID.String(), false)
+}
+
+// scheduleRestart restarts a task that stopped running once its backoff has
+// passed, if its restart policy asks for it.
+func (m *Manager) scheduleRestart(task entities.Task, now time.Time) {
+	reason := task.LastTerminationReason
+	if reason == "" {
+		reason = entities.TerminationError
+		if task.State == entities.TaskCompleted {
+			reason = entities.TerminationCompleted
+		}
+	}
+	if !task.ShouldRestart(reason) {
+		if task.NextRestartAt != nil {
+			m.setNextRestart(task, nil)
+		}
+		return
+	}
+
+	if task.NextRestartAt == nil {
+		next := now.Add(task.RestartBackoff())
+		if m.setNextRestart(task, &next) {
+			log.Printf("Task %s stopped (%s), restarting at %s\n", task.ID, reason, next.Format(time.RFC3339))
+		}
+		return
+	}
+	if now.Before(*task.NextRestartAt) {
+		return
+	}
+	m.restartTask(task)
+}
+
+// resetRestarts forgets the restarts of a task that has been running stably,
+// unless it has changed state or been restarted since it was read.
+func (m *Manager) resetRestarts(task entities.Task) {
+	m.TaskDb.Update(task.ID, func(t *entities.Task, ok bool) bool {
+		if !ok || t.State != entities.TaskRunning || t.RestartCount != task.RestartCount {
+			return false
+		}
+		log.Printf("Task %s has been running since %s, resetting its %d restarts\n",
+			task.ID, task.StartsAt.Format(time.RFC3339), t.RestartCount)
+		t.RestartCount = 0
+		return true
+	})
+}
+
+// setNextRestart records when the task is due to be restarted, unless it has
+// changed state or been restarted since it was read.
+func (m *Manager) setNextRestart(task entities.Task, next *time.Time) bool {
+	changed := false
+	m.TaskDb.Update(task.ID, func(t *entities.Task, ok bool) bool {
+		if !ok || t.State != task.State || t.RestartCount != task.RestartCount {
+			return false
+		}
+		t.NextRestartAt = next
+		changed = true
+		return true
+	})
+	return changed
+}
+
+// checkReadiness starts the task's readiness probe when it is due. A running
+// task without a readiness probe is always ready.
+func (m *Manager) checkReadiness(task entities.Task, now time.Time) {
+	p := task.ReadinessProbe
+	if p == nil {
+		delete(m.readiness, task.ID)
+		m.setReady(task.ID, true)
+		return
+	}
+	if state := due(m.readiness, &task, p, now); state != nil {
+		m.startProbe(task, p, state, false)
+	}
+}
+
+// readinessResult marks the task ready after a successful readiness probe and
+// not ready after FailureThreshold failures in a row.
+func (m *Manager) readinessResult(task entities.Task, p *entities.Probe, state *healthState, err error) {
+	if err == nil {
+		state.failures = 0
+		if !task.Ready {
+			log.Printf("Task %s is ready\n", task.ID)
+		}
+		m.setReady(task.ID, true)
+		return
+	}
+	state.failures++
+	log.Printf("Readiness check %d/%d for task %s failed: %v\n", state.failures, p.Threshold(), task.ID, err)
+	if state.failures >= p.Threshold() && task.Ready {
+		log.Printf("Task %s is not ready\n", task.ID)
+		m.setReady(task.ID, false)
+	}
+}
+
+// setReady records the task's readiness. Only running tasks can be ready.
+func (m *Manager) setReady(id uuid.UUID, ready bool) {
+	m.TaskDb.Update(id, func(t *entities.Task, ok bool) bool {
+		if !ok || t.Ready == ready || (ready && t.State != entities.TaskRunning) {
+			return false
+		}
+		t.Ready = ready
+		return true
+	})
+}
+
+func (m *Manager) forgetProbes(id uuid.UUID) {
+	delete(m.health, id)
+	delete(m.readiness, id)
+	m.setReady(id, false)
+}
+
+func (m *Manager) doHealthCheck() {
+	m.applyProbeResults()
+	now := time.Now()
+	for _, task := range m.TaskDb.List() {
+		switch {
+		case task.State == entities.TaskRunning:
+			if task.RanStably(now) {
+				m.resetRestarts(task)
+			}
+			m.checkLiveness(task, now)
+			m.checkReadiness(task, now)
+		case isTerminal(task.State):
+			m.forgetProbes(task.ID)
+			m.scheduleRestart(task, now)
+		default:
+			m.forgetProbes(task.ID)
+		}
+	}
+}
+
+// nextHealthCheck returns when the next probe or restart is due, at most the
+// resync period from now. Running probes wake the loop when they finish.
+func (m *Manager) nextHealthCheck(now time.Time) time.Time {
+	next := now.Add(m.resyncPeriod())
+	for _, states := range []map[uuid.UUID]*healthState{m.health, m.readiness} {
+		for _, state := range states {
+			if !state.probing && state.nextCheck.Before(next) {
+				next = state.nextCheck
+			}
+		}
+	}
+	for _, task := range m.TaskDb.List() {
+		if isTerminal(task.State) && task.NextRestartAt != nil && task.NextRestartAt.Before(next) {
+			next = *task.NextRestartAt
+		}
+	}
+	return next
+}
+
+// DoHealthChecks probes every running task on its own interval and restarts
+// stopped tasks when their backoff has passed. Probes run concurrently; the
+// loop sleeps until the next probe or restart is due, a probe finishes or a
+// task changes state.
+func (m *Manager) DoHealthChecks() {
+	log.Println("Performing health checks")
+	for {
+		m.doHealthCheck()
+		now := time.Now()
+		m.tasksChanged.Wait(max(m.nextHealthCheck(now).Sub(now), 0))
+	}
+}
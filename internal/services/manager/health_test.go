@@ -0,0 +1,142 @@
+package manager
+
+import (
+	"errors"
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"orc/domain/core/scheduler"
+	"orc/domain/entities"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProbesRunConcurrently(t *testing.T) {
+	arrived := make(chan struct{}, 2)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	m := NewManager([]string{"127.0.0.1:1"}, scheduler.DefaultProfiles()["roundrobin"])
+	var ids []uuid.UUID
+	for range 2 {
+		task := entities.Task{
+			ID:             uuid.New(),
+			State:          entities.TaskRunning,
+			HostPorts:      nat.PortMap{"80/tcp": {{HostIP: "127.0.0.1", HostPort: port}}},
+			ReadinessProbe: &entities.Probe{Type: entities.ProbeHTTP, Path: "/ready", TimeoutSeconds: 5},
+		}
+		m.TaskDb.Put(task.ID, task)
+		m.TaskWorkerMap.Put(task.ID, "127.0.0.1:1")
+		ids = append(ids, task.ID)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.doHealthCheck()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("health check waited for the probes")
+	}
+	for range 2 {
+		select {
+		case <-arrived:
+		case <-time.After(time.Second):
+			t.Fatal("probes did not run concurrently")
+		}
+	}
+
+	// A probe still running is not started again, even once it is due.
+	for _, id := range ids {
+		m.readiness[id].nextCheck = time.Time{}
+	}
+	m.doHealthCheck()
+	time.Sleep(100 * time.Millisecond)
+	if len(arrived) != 0 {
+		t.Errorf("%d probes started while the first ones were running", len(arrived))
+	}
+	close(release)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		m.doHealthCheck()
+		ready := 0
+		for _, id := range ids {
+			if task, _ := m.TaskDb.Get(id); task.Ready {
+				ready++
+			}
+		}
+		if ready == len(ids) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d tasks ready after their probes passed", ready, len(ids))
+		}
+		m.tasksChanged.Wait(50 * time.Millisecond)
+	}
+}
+
+func TestLivenessRestartBacksOff(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	worker := strings.TrimPrefix(srv.URL, "http://")
+
+	m := NewManager([]string{worker}, scheduler.DefaultProfiles()["roundrobin"])
+	probe := &entities.Probe{Type: entities.ProbeHTTP, Path: "/health", FailureThreshold: 1}
+	task := entities.Task{ID: uuid.New(), State: entities.TaskRunning, RestartPolicy: "Always", HealthProbe: probe}
+	m.TaskDb.Put(task.ID, task)
+	m.TaskWorkerMap.Put(task.ID, worker)
+
+	m.livenessResult(task, probe, &healthState{}, errors.New("connection refused"))
+
+	mu.Lock()
+	got := strings.Join(requests, ",")
+	mu.Unlock()
+	if got != http.MethodDelete {
+		t.Fatalf("requests to the worker = %q, want a single DELETE", got)
+	}
+	if reason, _ := m.stopReasons.Get(task.ID); reason != entities.TerminationUnhealthy {
+		t.Errorf("stop reason = %q, want %q", reason, entities.TerminationUnhealthy)
+	}
+
+	// The worker reports the task stopped and its restart waits for the
+	// backoff.
+	stopped, _ := m.TaskDb.Update(task.ID, func(t *entities.Task, _ bool) bool {
+		t.State = entities.TaskCompleted
+		t.LastTerminationReason = entities.TerminationUnhealthy
+		return true
+	})
+	now := time.Now()
+	m.scheduleRestart(stopped, now)
+
+	waiting, _ := m.TaskDb.Get(task.ID)
+	if waiting.State != entities.TaskCompleted {
+		t.Errorf("state = %v, want %v until the backoff has passed", waiting.State, entities.TaskCompleted)
+	}
+	if waiting.NextRestartAt == nil || !waiting.NextRestartAt.After(now) {
+		t.Errorf("next restart = %v, want after %v", waiting.NextRestartAt, now)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 1 {
+		t.Errorf("requests to the worker = %v, want no restart before the backoff", requests)
+	}
+}
@@ -1,61 +1,114 @@
 package manager
 
 import (
+	"errors"
 	"fmt"
-	"github.com/golang-collections/collections/queue"
 	"github.com/google/uuid"
+	"log"
 	"orc/domain/core/scheduler"
 	"orc/domain/entities"
+	"orc/internal/infrastructure/store"
+	"orc/pkg/xqueue"
+	"orc/pkg/xsync"
+	"sync"
+	"time"
 )
 
+const (
+	defaultResyncPeriod = 15 * time.Second
+	// stopTaskTimeout bounds how long the manager waits for a worker to
+	// accept a stop request.
+	stopTaskTimeout = 10 * time.Second
+)
+
+var ErrTaskNotFound = errors.New("task not found")
+
+// WorkerError is a non-success response from a worker.
+type WorkerError struct {
+	Worker     string
+	StatusCode int
+	Message    string
+}
+
+func (e *WorkerError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("worker %s returned status %d", e.Worker, e.StatusCode)
+	}
+	return fmt.Sprintf("worker %s returned status %d: %s", e.Worker, e.StatusCode, e.Message)
+}
+
 type Manager struct {
-	Pending       queue.Queue
-	TaskDb        map[uuid.UUID]*entities.Task
-	EventDb       map[uuid.UUID]*entities.TaskEvent
+	Pending       *xqueue.PriorityQueue[entities.TaskEvent]
+	TaskDb        store.Store[uuid.UUID, entities.Task]
+	EventDb       store.Store[uuid.UUID, entities.TaskEvent]
 	Workers       []string
-	WorkerTaskMap map[string][]uuid.UUID
-	TaskWorkerMap map[uuid.UUID]string
+	WorkerTaskMap store.Store[string, []uuid.UUID]
+	TaskWorkerMap store.Store[uuid.UUID, string]
 	LastWorker    int
+	// stopReasons holds why the manager stopped a task until the worker
+	// reports it stopped, as the worker only knows it was asked to.
+	stopReasons store.Store[uuid.UUID, string]
 
 	WorkerNodes []*entities.Node
 	Scheduler   scheduler.Scheduler
-}
+	// ResyncPeriod is how often the work loops run when nothing wakes them,
+	// 15 seconds if unset.
+	ResyncPeriod time.Duration
 
-func NewManager(workers []string, schedulerType string) *Manager {
-	taskDb := make(map[uuid.UUID]*entities.Task)
-	eventDb := make(map[uuid.UUID]*entities.TaskEvent)
-	workerTaskMap := make(map[string][]uuid.UUID)
-	taskWorkerMap := make(map[uuid.UUID]string)
-	for worker := range workers {
-		workerTaskMap[workers[worker]] = []uuid.UUID{}
-	}
+	// schedMu guards the scheduler, which keeps state between calls. It is
+	// held while the extenders are called, so nodeMu is never held with it.
+	schedMu sync.Mutex
+	// nodeMu guards WorkerNodes.
+	nodeMu sync.Mutex
+
+	// workAdded wakes ProcessTasks, tasksChanged wakes DoHealthChecks
+	// when a task changes state or a probe has finished.
+	workAdded    xsync.Signal
+	tasksChanged xsync.Signal
+
+	// health and readiness are only used by the health check loop.
 
+	health    map[uuid.UUID]*healthState
+	readiness map[uuid.UUID]*healthState
+	// probeResults holds the results of finished probes until the health
+	// check loop applies them.
+	probeResults *xqueue.Queue[probeResult]
+}
+
+func NewManager(workers []string, profile scheduler.Profile) *Manager {
+	workerTaskMap := store.NewMemory[string, []uuid.UUID]()
 	var nodes []*entities.Node
 	for worker := range workers {
-		workerTaskMap[workers[worker]] = []uuid.UUID{}
+		workerTaskMap.Put(workers[worker], []uuid.UUID{})
 
 		nAPI := fmt.Sprintf("http://%v", workers[worker])
 		n := entities.NewNode(workers[worker], nAPI, "worker")
 		nodes = append(nodes, n)
 	}
 
-	var s scheduler.Scheduler
-	switch schedulerType {
-	case "roundrobin":
-		s = &scheduler.RoundRobin{Name: "roundrobin"}
-	default:
-		s = &scheduler.RoundRobin{Name: "roundrobin"}
+	s, err := scheduler.NewFramework(profile)
+	if err != nil {
+		log.Printf("Error building scheduler %s, falling back to roundrobin: %v\n", profile.Name, err)
+		s, _ = scheduler.NewFramework(scheduler.DefaultProfiles()["roundrobin"])
 	}
 
 	return &Manager{
-		Pending:       *queue.New(),
-		TaskDb:        taskDb,
-		EventDb:       eventDb,
+		Pending:       xqueue.NewPriorityQueue(taskEventPriority),
+		TaskDb:        store.NewMemory[uuid.UUID, entities.Task](),
+		EventDb:       store.NewMemory[uuid.UUID, entities.TaskEvent](),
 		Workers:       workers,
 		WorkerTaskMap: workerTaskMap,
-		TaskWorkerMap: taskWorkerMap,
+		TaskWorkerMap: store.NewMemory[uuid.UUID, string](),
+		stopReasons:   store.NewMemory[uuid.UUID, string](),
 		LastWorker:    0,
 		WorkerNodes:   nodes,
 		Scheduler:     s,
+		health:        make(map[uuid.UUID]*healthState),
+		readiness:     make(map[uuid.UUID]*healthState),
+		probeResults:  xqueue.NewQueue[probeResult](),
 	}
 }
+
+func taskEventPriority(e entities.TaskEvent) int {
+	return e.Task.Priority
+}
@@ -0,0 +1,168 @@
+package manager
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"net/http"
+	"net/http/httptest"
+	"orc/domain/core/scheduler"
+	"orc/domain/entities"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateTasksKeepsManagerState(t *testing.T) {
+	id := uuid.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]entities.Task{{
+			ID:                    id,
+			State:                 entities.TaskCompleted,
+			RestartCount:          1,
+			LastTerminationReason: entities.TerminationStopped,
+		}})
+	}))
+	defer srv.Close()
+	worker := strings.TrimPrefix(srv.URL, "http://")
+
+	m := NewManager([]string{worker}, scheduler.DefaultProfiles()["roundrobin"])
+	m.TaskDb.Put(id, entities.Task{ID: id, State: entities.TaskRunning, RestartCount: 2, RestartPolicy: "Never"})
+	m.TaskWorkerMap.Put(id, worker)
+	m.stopReasons.Put(id, entities.TerminationUnhealthy)
+
+	m.updateTasks()
+
+	got, _ := m.TaskDb.Get(id)
+	if got.State != entities.TaskCompleted {
+		t.Errorf("state = %v, want %v", got.State, entities.TaskCompleted)
+	}
+	if got.LastTerminationReason != entities.TerminationUnhealthy {
+		t.Errorf("termination reason = %q, want %q", got.LastTerminationReason, entities.TerminationUnhealthy)
+	}
+	if got.RestartCount != 2 {
+		t.Errorf("restart count = %d, want 2", got.RestartCount)
+	}
+	if _, ok := m.stopReasons.Get(id); ok {
+		t.Error("stop reason kept after the task stopped")
+	}
+}
+
+func TestRestartCountReset(t *testing.T) {
+	tests := []struct {
+		name    string
+		running time.Duration
+		want    int
+	}{
+		{"stable", 11 * time.Minute, 0},
+		{"recent", time.Minute, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(nil, scheduler.DefaultProfiles()["roundrobin"])
+			started := time.Now().Add(-tt.running)
+			task := entities.Task{ID: uuid.New(), State: entities.TaskRunning, RestartCount: 3, StartsAt: &started}
+			m.TaskDb.Put(task.ID, task)
+
+			m.doHealthCheck()
+
+			got, _ := m.TaskDb.Get(task.ID)
+			if got.RestartCount != tt.want {
+				t.Errorf("restart count = %d, want %d", got.RestartCount, tt.want)
+			}
+		})
+	}
+}
+
+// reportingWorker serves the task as the worker's only task until it is
+// closed, returning its address.
+func reportingWorker(t *testing.T, report *entities.Task) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]entities.Task{*report})
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func TestUpdateTasksIgnoresRunBeforeRestart(t *testing.T) {
+	id := uuid.New()
+	oldStart := time.Now().Add(-time.Minute)
+	report := entities.Task{ID: id, State: entities.TaskFailed, StartsAt: &oldStart, RestartPolicy: "Always"}
+	worker := reportingWorker(t, &report)
+
+	m := NewManager([]string{worker}, scheduler.DefaultProfiles()["roundrobin"])
+	restarted := entities.Task{ID: id, State: entities.TaskScheduled, StartsAt: &oldStart, RestartCount: 1, RestartPolicy: "Always"}
+	m.TaskDb.Put(id, restarted)
+	m.TaskWorkerMap.Put(id, worker)
+	m.WorkerNodes[0].Allocate(restarted)
+
+	m.updateTasks()
+
+	got, _ := m.TaskDb.Get(id)
+	if got.State != entities.TaskScheduled {
+		t.Errorf("state = %v, want %v", got.State, entities.TaskScheduled)
+	}
+	if _, ok := m.WorkerNodes[0].Tasks[id]; !ok {
+		t.Error("node released by a report of the run before the restart")
+	}
+
+	newStart := time.Now()
+	report = entities.Task{ID: id, State: entities.TaskRunning, StartsAt: &newStart, RestartPolicy: "Always"}
+	next := time.Now().Add(time.Minute)
+	m.TaskDb.Update(id, func(t *entities.Task, _ bool) bool {
+		t.NextRestartAt = &next
+		return true
+	})
+
+	m.updateTasks()
+
+	got, _ = m.TaskDb.Get(id)
+	if got.State != entities.TaskRunning {
+		t.Errorf("state = %v, want %v", got.State, entities.TaskRunning)
+	}
+	if got.NextRestartAt != nil {
+		t.Errorf("next restart = %v, want none once running", got.NextRestartAt)
+	}
+}
+
+func TestNextHealthCheckIgnoresRunningRestarts(t *testing.T) {
+	m := NewManager(nil, scheduler.DefaultProfiles()["roundrobin"])
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	m.TaskDb.Put(uuid.New(), entities.Task{State: entities.TaskRunning, NextRestartAt: &past})
+
+	if next := m.nextHealthCheck(now); !next.Equal(now.Add(m.resyncPeriod())) {
+		t.Errorf("next health check in %v, want the resync period", next.Sub(now))
+	}
+
+	soon := now.Add(time.Second)
+	m.TaskDb.Put(uuid.New(), entities.Task{State: entities.TaskFailed, NextRestartAt: &soon})
+	if next := m.nextHealthCheck(now); !next.Equal(soon) {
+		t.Errorf("next health check in %v, want %v", next.Sub(now), time.Second)
+	}
+}
+
+func TestRestartTaskUnreachableWorker(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	worker := strings.TrimPrefix(srv.URL, "http://")
+	srv.Close()
+
+	m := NewManager([]string{worker}, scheduler.DefaultProfiles()["roundrobin"])
+	m.WorkerNodes[0].Memory = 1024
+	task := entities.Task{ID: uuid.New(), State: entities.TaskFailed, Memory: 512, RestartPolicy: "Always"}
+	m.TaskDb.Put(task.ID, task)
+	m.TaskWorkerMap.Put(task.ID, worker)
+	m.WorkerTaskMap.Put(worker, []uuid.UUID{task.ID})
+
+	m.restartTask(task)
+
+	node := m.WorkerNodes[0]
+	if _, ok := node.Tasks[task.ID]; ok || node.MemoryAllocated != 0 {
+		t.Errorf("node keeps %d bytes allocated after the restart failed", node.MemoryAllocated)
+	}
+	if _, ok := m.TaskWorkerMap.Get(task.ID); ok {
+		t.Error("task still placed on the unreachable worker")
+	}
+	if m.Pending.Len() != 1 {
+		t.Errorf("pending events = %d, want 1", m.Pending.Len())
+	}
+}
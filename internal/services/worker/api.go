@@ -1,13 +1,23 @@
 package worker
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"io"
 	"log"
 	"net/http"
 	"orc/domain/entities"
+	"orc/internal/infrastructure/containerrt"
+	"orc/pkg/xhttp"
+	"strconv"
+	"sync"
+	"time"
 )
 
 type API struct {
@@ -29,6 +39,9 @@ func (a *API) initRouter() {
 		r.Get("/", a.GetTasksHandler)
 		r.Route("/{taskID}", func(r chi.Router) {
 			r.Delete("/", a.StopTaskHandler)
+			r.Get("/logs", a.GetTaskLogsHandler)
+			r.Post("/exec", a.ExecTaskHandler)
+			r.Get("/exec/ws", a.ExecTaskWebSocketHandler)
 		})
 	})
 	a.Router.Route("/stats", func(r chi.Router) {
@@ -36,16 +49,21 @@ func (a *API) initRouter() {
 	})
 }
 
-func (a *API) Start() error {
+// Handler returns the API's routes without starting a server for them.
+func (a *API) Handler() http.Handler {
 	a.initRouter()
-	err := http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router)
+	return a.Router
+}
+
+func (a *API) Start() error {
+	err := http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Handler())
 	return err
 }
 
 func (a *API) GetStatsHandler(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	err := json.NewEncoder(w).Encode(a.Worker.Stats)
+	err := json.NewEncoder(w).Encode(a.Worker.GetStats())
 	if err != nil {
 		log.Println(err)
 		return
@@ -73,8 +91,9 @@ func (a *API) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	a.Worker.AddTask(taskEvent.Task)
+	a.Worker.AddTask(taskEvent)
 	log.Printf("Task added: %v\n", taskEvent.Task.ID)
+	taskEvent.Task = taskEvent.Task.Redacted()
 	w.WriteHeader(http.StatusCreated)
 	err = json.NewEncoder(w).Encode(taskEvent)
 	if err != nil {
@@ -86,7 +105,7 @@ func (a *API) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 func (a *API) GetTasksHandler(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	err := json.NewEncoder(w).Encode(a.Worker.GetTasks())
+	err := json.NewEncoder(w).Encode(entities.RedactTasks(a.Worker.GetTasks()))
 	if err != nil {
 		log.Println(err)
 		return
@@ -98,25 +117,238 @@ func (a *API) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 	if taskID == "" {
 		log.Printf("Invalid task ID: %v\n", taskID)
 		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
 	tID, err := uuid.Parse(taskID)
 	if err != nil {
 		log.Printf("Invalid task ID: %v\n", taskID)
 		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
-	_, ok := a.Worker.Db[tID]
+	taskToStop, ok := a.Worker.Db.Update(tID, markStopping)
 	if !ok {
 		log.Printf("Task not found: %v\n", tID)
 		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 
-	taskToStop := a.Worker.Db[tID]
-	taskCopy := *taskToStop
+	taskCopy := taskToStop
 	taskCopy.State = entities.TaskCompleted
-	a.Worker.AddTask(taskCopy)
+	a.Worker.AddTask(entities.TaskEvent{
+		ID:            uuid.New(),
+		State:         entities.TaskCompleted,
+		RequestedAt:   time.Now(),
+		Task:          taskCopy,
+		RemoveVolumes: r.URL.Query().Get("removeVolumes") == "true",
+	})
 
 	log.Printf("Added task %v to stop container %v\n", taskToStop.ID, taskToStop.ContainerID)
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func taskErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrNoContainer), errors.Is(err, ErrNotRunning):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GetTaskLogsHandler writes the task's container logs as plain text. The
+// follow, tail and since query parameters match the Docker logs options and
+// stream limits the output to stdout or stderr.
+func (a *API) GetTaskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		log.Printf("Invalid task ID: %v\n", chi.URLParam(r, "taskID"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	options := containerrt.LogsOptions{
+		Follow: query.Get("follow") == "true",
+		Tail:   query.Get("tail"),
+		Since:  query.Get("since"),
+	}
+
+	fw := xhttp.NewFlushWriter(w)
+	var stdout, stderr io.Writer = fw, fw
+	switch query.Get("stream") {
+	case "stdout":
+		stderr = io.Discard
+	case "stderr":
+		stdout = io.Discard
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	err = a.Worker.TaskLogs(r.Context(), tID, options, stdout, stderr)
+	if err != nil {
+		log.Printf("Error getting logs for task %v: %v\n", tID, err)
+		// Once logs have been streamed the status is sent, so the stream
+		// just ends.
+		if !fw.Written() {
+			w.WriteHeader(taskErrorStatus(err))
+		}
+	}
+}
+
+func (a *API) ExecTaskHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		log.Printf("Invalid task ID: %v\n", chi.URLParam(r, "taskID"))
+		writeError(w, http.StatusBadRequest, "invalid task id")
+		return
+	}
+
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	req := entities.ExecRequest{}
+	err = d.Decode(&req)
+	if err != nil || len(req.Cmd) == 0 {
+		msg := fmt.Sprintf("Error unmarshalling body: %v\n", err)
+		log.Println(msg)
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	var stdout, stderr bytes.Buffer
+	options := containerrt.ExecOptions{Cmd: req.Cmd, Env: req.Env}
+	code, err := a.Worker.ExecTask(r.Context(), tID, options, nil, &stdout, &stderr)
+	if err != nil {
+		log.Printf("Error executing %v in task %v: %v\n", req.Cmd, tID, err)
+		writeError(w, taskErrorStatus(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(entities.ExecResult{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		ExitCode: code,
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Interactive exec frames are binary WebSocket messages whose first byte is
+// the channel: the client sends stdin on ExecStdin (an empty frame closes
+// stdin), the worker sends output on ExecStdout and ExecStderr and finally
+// the exit code, or an error message, on ExecExit.
+const (
+	ExecStdin byte = iota
+	ExecStdout
+	ExecStderr
+	ExecExit
+)
+
+var upgrader = websocket.Upgrader{}
+
+// ExecTaskWebSocketHandler runs the command given by the repeated cmd query
+// parameter interactively, tty=true allocates a terminal.
+func (a *API) ExecTaskWebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		log.Printf("Invalid task ID: %v\n", chi.URLParam(r, "taskID"))
+		writeError(w, http.StatusBadRequest, "invalid task id")
+		return
+	}
+	query := r.URL.Query()
+	options := containerrt.ExecOptions{
+		Cmd: query["cmd"],
+		Tty: query.Get("tty") == "true",
+	}
+	if len(options.Cmd) == 0 {
+		writeError(w, http.StatusBadRequest, "cmd is required")
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Error upgrading exec connection for task %v: %v\n", tID, err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stdin, stdinWriter := io.Pipe()
+	go func() {
+		defer cancel()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				stdinWriter.CloseWithError(err)
+				return
+			}
+			if len(data) == 0 || data[0] != ExecStdin {
+				continue
+			}
+			if len(data) == 1 {
+				stdinWriter.Close()
+				continue
+			}
+			if _, err := stdinWriter.Write(data[1:]); err != nil {
+				return
+			}
+		}
+	}()
+
+	out := &wsWriter{conn: conn}
+	code, err := a.Worker.ExecTask(ctx, tID, options, stdin, out.channel(ExecStdout), out.channel(ExecStderr))
+	status := strconv.Itoa(code)
+	if err != nil {
+		log.Printf("Error executing %v in task %v: %v\n", options.Cmd, tID, err)
+		status = err.Error()
+	}
+	_ = out.write(ExecExit, []byte(status))
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+// wsWriter serializes channel frames onto a WebSocket connection.
+type wsWriter struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (ww *wsWriter) write(channel byte, p []byte) error {
+	ww.mu.Lock()
+	defer ww.mu.Unlock()
+	return ww.conn.WriteMessage(websocket.BinaryMessage, append([]byte{channel}, p...))
+}
+
+func (ww *wsWriter) channel(channel byte) io.Writer {
+	return channelWriter{ww: ww, channel: channel}
+}
+
+type channelWriter struct {
+	ww      *wsWriter
+	channel byte
+}
+
+func (cw channelWriter) Write(p []byte) (int, error) {
+	if err := cw.ww.write(cw.channel, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	e := ErrResponse{
+		HTTPStatusCode: status,
+		Message:        msg,
+	}
+	err := json.NewEncoder(w).Encode(e)
+	if err != nil {
+		log.Println(err)
+	}
+}
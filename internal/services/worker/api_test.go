@@ -0,0 +1,217 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"orc/domain/entities"
+	"orc/internal/apitest"
+	"orc/internal/infrastructure/fake"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAPIParallelTasks(t *testing.T) {
+	rt := fake.NewRuntime()
+	w := newTestWorker(rt)
+	w.ResyncPeriod = 20 * time.Millisecond
+	go w.RunTasks()
+	srv := httptest.NewServer((&API{Worker: w}).Handler())
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			task := newTestTask("app:1.0")
+			if err := apitest.RunAndStop(srv.URL, task); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(rt.Containers()); n != 0 {
+		t.Errorf("%d containers left after every task was stopped", n)
+	}
+	if n := w.Db.Len(); n != 20 {
+		t.Errorf("worker knows %d tasks, want 20", n)
+	}
+}
+
+// startTestTask runs a task from the image on the worker and serves the
+// worker's API.
+func startTestTask(t *testing.T, rt *fake.Runtime, image string) (*Worker, entities.Task, *httptest.Server) {
+	t.Helper()
+	w := newTestWorker(rt)
+	task := newTestTask(image)
+	result := w.RunTask(entities.TaskEvent{State: task.State, Task: task})
+	if result.Error != nil {
+		t.Fatalf("RunTask: %v", result.Error)
+	}
+	srv := httptest.NewServer((&API{Worker: w}).Handler())
+	t.Cleanup(srv.Close)
+	return w, task, srv
+}
+
+func TestAPILogs(t *testing.T) {
+	tests := []struct {
+		name     string
+		behavior fake.Behavior
+		query    string
+		status   int
+		body     string
+	}{
+		{"both streams", fake.Behavior{Stdout: "out\n", Stderr: "err\n"}, "", http.StatusOK, "out\nerr\n"},
+		{"stdout only", fake.Behavior{Stdout: "out\n", Stderr: "err\n"}, "?stream=stdout", http.StatusOK, "out\n"},
+		{"stderr only", fake.Behavior{Stdout: "out\n", Stderr: "err\n"}, "?stream=stderr", http.StatusOK, "err\n"},
+		{"error before output", fake.Behavior{LogsError: errors.New("broken")}, "", http.StatusInternalServerError, ""},
+		{"error after output", fake.Behavior{Stdout: "out\n", LogsError: errors.New("broken")}, "", http.StatusOK, "out\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := fake.NewRuntime()
+			rt.Script("app:1.0", tt.behavior)
+			_, task, srv := startTestTask(t, rt, "app:1.0")
+
+			resp, err := http.Get(srv.URL + "/tasks/" + task.ID.String() + "/logs" + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestAPILogsUnknownTask(t *testing.T) {
+	srv := httptest.NewServer((&API{Worker: newTestWorker(fake.NewRuntime())}).Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/tasks/" + uuid.NewString() + "/logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestAPIExec(t *testing.T) {
+	rt := fake.NewRuntime()
+	rt.Script("app:1.0", fake.Behavior{
+		Exec: func(cmd []string, _ io.Reader, stdout, stderr io.Writer) int {
+			fmt.Fprintln(stdout, strings.Join(cmd, " "))
+			fmt.Fprintln(stderr, "warning")
+			return 3
+		},
+	})
+	w, task, srv := startTestTask(t, rt, "app:1.0")
+
+	exec := func(id uuid.UUID) *http.Response {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/tasks/"+id.String()+"/exec", "application/json",
+			strings.NewReader(`{"Cmd": ["echo", "hi"]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := exec(task.ID)
+	var result entities.ExecResult
+	err := json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("decoding exec result: %v", err)
+	}
+	if result.Stdout != "echo hi\n" || result.Stderr != "warning\n" || result.ExitCode != 3 {
+		t.Errorf("exec result = %+v", result)
+	}
+
+	resp = exec(uuid.New())
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown task: status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	w.Db.Update(task.ID, markStopping)
+	resp = exec(task.ID)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("stopping task: status = %d, want %d", resp.StatusCode, http.StatusConflict)
+	}
+}
+
+func TestAPIGracefulStop(t *testing.T) {
+	hookStarted, releaseHook := make(chan struct{}), make(chan struct{})
+	rt := fake.NewRuntime()
+	rt.Script("app:1.0", fake.Behavior{
+		Exec: func(cmd []string, _ io.Reader, _, _ io.Writer) int {
+			close(hookStarted)
+			<-releaseHook
+			return 0
+		},
+	})
+	w := newTestWorker(rt)
+	w.ResyncPeriod = 20 * time.Millisecond
+	go w.RunTasks()
+	srv := httptest.NewServer((&API{Worker: w}).Handler())
+	defer srv.Close()
+
+	task := newTestTask("app:1.0")
+	task.StopSignal = "SIGINT"
+	task.PreStop = &entities.Hook{Type: entities.HookExec, Command: []string{"drain"}}
+	w.AddTask(entities.TaskEvent{ID: uuid.New(), State: entities.TaskRunning, Task: task})
+	if err := apitest.WaitForState(srv.URL, task.ID, entities.TaskRunning); err != nil {
+		t.Fatal(err)
+	}
+	running, _ := w.Db.Get(task.ID)
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/tasks/"+task.ID.String(), nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE: status %d", resp.StatusCode)
+	}
+
+	<-hookStarted
+	if got, _ := w.Db.Get(task.ID); got.State != entities.TaskStopping {
+		t.Errorf("state while the PreStop hook runs = %v, want %v", got.State, entities.TaskStopping)
+	}
+	if _, stopped := rt.Stopped(running.ContainerID); stopped {
+		t.Error("container stopped before the PreStop hook finished")
+	}
+	close(releaseHook)
+
+	if err := apitest.WaitForState(srv.URL, task.ID, entities.TaskCompleted); err != nil {
+		t.Fatal(err)
+	}
+	options, ok := rt.Stopped(running.ContainerID)
+	if !ok {
+		t.Fatal("container not stopped")
+	}
+	if options.Signal != "SIGINT" {
+		t.Errorf("stop signal = %q, want SIGINT", options.Signal)
+	}
+	if options.Timeout <= 0 || options.Timeout > 10*time.Second {
+		t.Errorf("stop timeout = %v, want within the grace period", options.Timeout)
+	}
+}
@@ -1,163 +1,484 @@
 package worker
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"io"
 	"log"
+	"net"
 	"orc/domain/entities"
-	"orc/internal/infrastructure/docker"
+	"orc/internal/infrastructure/containerrt"
+	"orc/internal/infrastructure/probe"
+	"orc/pkg/xpool"
 	"orc/pkg/xstats"
 	"time"
 )
 
+func (w *Worker) GetStats() *xstats.Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.Stats
+}
+
 func (w *Worker) CollectStats() {
 	for {
 		log.Println("Collecting stats...")
-		w.Stats = xstats.GetStats()
-		w.Stats.TaskCount = w.TaskCount
-		time.Sleep(15 * time.Second)
+		stats := xstats.GetStats()
+		w.mu.Lock()
+		stats.TaskCount = w.TaskCount
+		w.Stats = stats
+		w.mu.Unlock()
+		time.Sleep(w.resyncPeriod())
 	}
 }
 
-func (w *Worker) RunTask() docker.Result {
-	t := w.Queue.Dequeue()
-	if t == nil {
-		log.Println("Queue is empty")
-		return docker.Result{Error: nil}
-	}
+// RunTask applies a task event taken from the queue: it starts, restarts or
+// stops the task's container.
+func (w *Worker) RunTask(te entities.TaskEvent) containerrt.Result {
+	taskQueued := te.Task
+	taskPersisted, _ := w.Db.Update(taskQueued.ID, func(t *entities.Task, ok bool) bool {
+		if ok {
+			return false
+		}
+		*t = taskQueued
+		return true
+	})
 
-	taskQueued := t.(entities.Task)
-	taskPersisted := w.Db[taskQueued.ID]
-	if taskPersisted == nil {
-		taskPersisted = &taskQueued
-		w.Db[taskQueued.ID] = taskPersisted
+	var result containerrt.Result
+	valid := taskPersisted.State.ValidateTransition(taskQueued.State)
+	if taskQueued.State == entities.TaskScheduled && taskPersisted.State.ValidateRequeue() {
+		// A preempted or restarted task comes back to the worker it
+		// ran on.
+		valid = true
 	}
-
-	var result docker.Result
-	if taskPersisted.State.ValidateTransition(taskQueued.State) {
+	if valid {
 		switch taskQueued.State {
 		case entities.TaskScheduled:
+			if taskPersisted.ContainerID != "" {
+				// A restart: the previous container has to go before its
+				// name can be reused.
+				w.removeContainer(taskPersisted)
+			}
 			result = w.StartTask(taskQueued)
 		case entities.TaskCompleted:
-			result = w.StopTask(taskQueued)
+			result = w.StopTask(taskQueued, te.RemoveVolumes)
 		default:
 			result.Error = errors.New("unreachable code")
 		}
 	} else {
-		err := fmt.Errorf("invalid transition from %v to %v", taskQueued.State, taskQueued.State)
+		err := fmt.Errorf("invalid transition from %v to %v", taskPersisted.State, taskQueued.State)
 		result.Error = err
 	}
 
 	return result
 }
 
-func (w *Worker) AddTask(task entities.Task) {
-	w.Queue.Enqueue(task)
+func (w *Worker) AddTask(te entities.TaskEvent) {
+	w.Queue.Enqueue(te)
+	w.tasksAdded.Notify()
 }
 
+func (w *Worker) resyncPeriod() time.Duration {
+	if w.ResyncPeriod <= 0 {
+		return defaultResyncPeriod
+	}
+	return w.ResyncPeriod
+}
+
+// RunTasks hands queued task events to a pool of Concurrency executors as
+// soon as they are added. Events for the same task are applied in order,
+// other tasks do not wait for them.
 func (w *Worker) RunTasks() {
+	concurrency := w.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	executors := xpool.NewKeyed[uuid.UUID](concurrency)
 	for {
-		if w.Queue.Len() != 0 {
-			result := w.RunTask()
-			if result.Error != nil {
-				log.Printf("Error running task: %v", result.Error)
+		for {
+			te, ok := w.Queue.Dequeue()
+			if !ok {
+				break
 			}
-		} else {
-			log.Println("No tasks to process currently")
+			executors.Submit(te.Task.ID, func() {
+				result := w.RunTask(te)
+				if result.Error != nil {
+					log.Printf("Error running task %v: %v", te.Task.ID, result.Error)
+				}
+			})
 		}
-		time.Sleep(10 * time.Second)
+		w.tasksAdded.Wait(w.resyncPeriod())
 	}
 }
 
-func (w *Worker) StartTask(t entities.Task) docker.Result {
+func (w *Worker) StartTask(t entities.Task) containerrt.Result {
 	now := time.Now()
 	t.StartsAt = &now
-	config := entities.NewOrcConfig(&t)
-	d, err := docker.NewDocker(config)
+	t.FinishedAt = nil
+	err := w.checkPorts(t)
 	if err != nil {
-		return docker.Result{Error: err}
+		log.Printf("Err running task: %v: %v\n", t.ID, err)
+		t.State = entities.TaskFailed
+		t.LastTerminationReason = entities.TerminationError
+		t.TerminationMessage = err.Error()
+		w.Db.Put(t.ID, t)
+		return containerrt.Result{Error: err}
 	}
 
-	result := d.Run()
+	for _, v := range t.Volumes {
+		if v.Type != entities.VolumeNamed {
+			continue
+		}
+		err = w.Runtime.CreateVolume(v.Source)
+		if err != nil {
+			log.Printf("Err creating volume %v for task %v: %v\n", v.Source, t.ID, err)
+			t.State = entities.TaskFailed
+			t.LastTerminationReason = entities.TerminationError
+			t.TerminationMessage = err.Error()
+			w.Db.Put(t.ID, t)
+			return containerrt.Result{Error: err}
+		}
+	}
+
+	err = w.pullImage(&t)
+	if err != nil {
+		log.Printf("Err pulling image %v for task %v: %v\n", t.Image, t.ID, err)
+		t.State = entities.TaskFailed
+		t.LastTerminationReason = entities.TerminationError
+		t.TerminationMessage = err.Error()
+		w.Db.Put(t.ID, t)
+		return containerrt.Result{Error: err}
+	}
+
+	config := entities.NewOrcConfig(&t)
+	result := w.Runtime.Run(config)
 	if result.Error != nil {
 		log.Printf("Err running task: %v: %v\n", t.ID, result.Error)
 		t.State = entities.TaskFailed
-		w.Db[t.ID] = &t
+		t.LastTerminationReason = entities.TerminationError
+		t.TerminationMessage = result.Error.Error()
+		w.Db.Put(t.ID, t)
 		return result
 	}
 
 	t.ContainerID = result.ContainerID
 	t.State = entities.TaskRunning
-	w.Db[t.ID] = &t
+	w.Db.Put(t.ID, t)
+	w.tasksStarted.Notify()
 
 	return result
 }
 
-func (w *Worker) StopTask(t entities.Task) docker.Result {
-	config := entities.NewOrcConfig(&t)
-	d, err := docker.NewDocker(config)
+// pullImage makes the task's image available according to its pull policy,
+// recording the progress of the pull on the task.
+func (w *Worker) pullImage(t *entities.Task) error {
+	policy := t.EffectivePullPolicy()
+	if policy != entities.PullAlways {
+		exists, err := w.Runtime.ImageExists(t.Image)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+		if policy == entities.PullNever {
+			return fmt.Errorf("image %s is not present and pull policy is %s", t.Image, policy)
+		}
+	}
+
+	t.ImagePull = &entities.ImagePullStatus{Status: "Pulling", UpdatedAt: time.Now()}
+	w.Db.Put(t.ID, *t)
+
+	layers := make(map[string]containerrt.PullProgress)
+	err := w.Runtime.PullImage(t.Image, w.registryAuth(*t), func(p containerrt.PullProgress) {
+		if p.Layer != "" {
+			if p.Total == 0 {
+				// Status-only updates come after a layer finished downloading.
+				p.Current, p.Total = layers[p.Layer].Total, layers[p.Layer].Total
+			}
+			layers[p.Layer] = p
+		}
+
+		status := &entities.ImagePullStatus{Status: p.Status, UpdatedAt: time.Now()}
+		for _, layer := range layers {
+			status.Current += layer.Current
+			status.Total += layer.Total
+		}
+		t.ImagePull = status
+		w.Db.Put(t.ID, *t)
+	})
+	if err != nil {
+		t.ImagePull = &entities.ImagePullStatus{Status: "Failed", Error: err.Error(), UpdatedAt: time.Now()}
+		return err
+	}
+
+	t.ImagePull = &entities.ImagePullStatus{
+		Status:    "Pulled",
+		Current:   t.ImagePull.Total,
+		Total:     t.ImagePull.Total,
+		UpdatedAt: time.Now(),
+	}
+	return nil
+}
+
+func (w *Worker) registryAuth(t entities.Task) *entities.RegistryAuth {
+	if t.RegistryAuth != nil {
+		return t.RegistryAuth
+	}
+	if auth, ok := w.RegistryAuths[entities.ImageRegistry(t.Image)]; ok {
+		return &auth
+	}
+	return nil
+}
+
+// checkPorts makes sure the task's fixed host ports are neither claimed by
+// another task on this worker nor already bound on the host.
+func (w *Worker) checkPorts(t entities.Task) error {
+	requested, err := entities.ParsePortBindings(t.PortBindings)
 	if err != nil {
-		return docker.Result{Error: err}
+		return err
+	}
+
+	for _, other := range w.Db.List() {
+		if other.ID == t.ID || (other.State != entities.TaskScheduled && other.State != entities.TaskRunning && other.State != entities.TaskStopping) {
+			continue
+		}
+		if port, ok := entities.ConflictingHostPort(requested, other.HostPortBindings()); ok {
+			return fmt.Errorf("host port %s already used by task %s", port, other.ID)
+		}
+	}
+
+	for port, bindings := range requested {
+		for _, binding := range bindings {
+			address := net.JoinHostPort(binding.HostIP, binding.HostPort)
+			if port.Proto() == "udp" {
+				conn, err := net.ListenPacket("udp", address)
+				if err != nil {
+					return fmt.Errorf("host port %s/udp is not available: %v", binding.HostPort, err)
+				}
+				conn.Close()
+				continue
+			}
+			l, err := net.Listen("tcp", address)
+			if err != nil {
+				return fmt.Errorf("host port %s/tcp is not available: %v", binding.HostPort, err)
+			}
+			l.Close()
+		}
 	}
+	return nil
+}
 
-	result := d.Stop(t.ContainerID)
+// markStopping is a store update moving a running task to TaskStopping.
+func markStopping(t *entities.Task, ok bool) bool {
+	if !ok || t.State != entities.TaskRunning {
+		return false
+	}
+	t.State = entities.TaskStopping
+	return true
+}
+
+// StopTask stops the task's container. Its named volumes are kept for the
+// next run unless removeVolumes is set.
+func (w *Worker) StopTask(t entities.Task, removeVolumes bool) containerrt.Result {
+	w.Db.Update(t.ID, markStopping)
+	result := w.stopContainer(t)
 	if result.Error != nil {
 		log.Printf("Error stopping container %v: %v\n", t.ContainerID, result.Error)
 	}
+	if removeVolumes {
+		for _, v := range t.Volumes {
+			if v.Type != entities.VolumeNamed {
+				continue
+			}
+			err := w.Runtime.RemoveVolume(v.Source)
+			if err != nil {
+				log.Printf("Error removing volume %v for task %v: %v\n", v.Source, t.ID, err)
+			}
+		}
+	}
 	now := time.Now()
 
 	t.FinishedAt = &now
 	t.State = entities.TaskCompleted
-	w.Db[t.ID] = &t
+	t.LastTerminationReason = entities.TerminationStopped
+	w.Db.Put(t.ID, t)
 	log.Printf("Stopped and removed container %v for task %v\n", t.ContainerID, t.ID)
 
 	return result
 }
 
-func (w *Worker) GetTasks() []entities.Task {
-	tasks := make([]entities.Task, 0, len(w.Db))
-	for _, task := range w.Db {
-		tasks = append(tasks, *task)
+// removeContainer stops the task's container if it still runs and removes
+// it. Containers that exited are kept until then for their logs.
+func (w *Worker) removeContainer(t entities.Task) {
+	resp := w.Runtime.Inspect(t.ContainerID)
+	if resp.Container == nil {
+		// Already removed when the task was stopped.
+		return
+	}
+	var result containerrt.Result
+	if resp.Container.State.Running {
+		result = w.stopContainer(t)
+	} else {
+		result = w.Runtime.Stop(t.ContainerID, containerrt.StopOptions{})
+	}
+	if result.Error != nil {
+		log.Printf("Error removing container %v of task %v: %v\n", t.ContainerID, t.ID, result.Error)
 	}
-	return tasks
 }
 
-func (w *Worker) InspectTask(task entities.Task) docker.InspectResponse {
-	config := entities.NewOrcConfig(&task)
-	d, err := docker.NewDocker(config)
-	if err != nil {
-		return docker.InspectResponse{Error: err}
+// stopContainer runs the task's PreStop hook and then stops its container
+// with the task's stop signal. The hook and the container share the task's
+// grace period; the container is killed once it has passed.
+func (w *Worker) stopContainer(t entities.Task) containerrt.Result {
+	deadline := time.Now().Add(t.StopGracePeriod())
+	if t.PreStop != nil {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		err := w.runHook(ctx, t, t.PreStop)
+		cancel()
+		if err != nil {
+			log.Printf("PreStop hook for task %v failed: %v\n", t.ID, err)
+		}
 	}
 
-	return d.Inspect(task.ContainerID)
+	return w.Runtime.Stop(t.ContainerID, containerrt.StopOptions{
+		Signal:  t.StopSignal,
+		Timeout: max(time.Until(deadline), 0),
+	})
+}
+
+func (w *Worker) runHook(ctx context.Context, t entities.Task, h *entities.Hook) error {
+	switch h.Type {
+	case entities.HookExec:
+		var stderr bytes.Buffer
+		exitCode, err := w.Runtime.Exec(ctx, t.ContainerID, containerrt.ExecOptions{Cmd: h.Command}, nil, io.Discard, &stderr)
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			return fmt.Errorf("command %v exited with %d: %s", h.Command, exitCode, stderr.String())
+		}
+		return nil
+	case entities.HookHTTP:
+		hostPort, err := entities.HostPort(t.HostPorts, h.Port)
+		if err != nil {
+			return err
+		}
+		return probe.HTTP(ctx, "localhost", hostPort, h.Path)
+	default:
+		return fmt.Errorf("unknown hook type %q", h.Type)
+	}
 }
 
+func (w *Worker) GetTasks() []entities.Task {
+	return w.Db.List()
+}
+
+func (w *Worker) InspectTask(task entities.Task) containerrt.InspectResponse {
+	return w.Runtime.Inspect(task.ContainerID)
+}
+
+func (w *Worker) TaskLogs(ctx context.Context, id uuid.UUID, options containerrt.LogsOptions, stdout, stderr io.Writer) error {
+	task, ok := w.Db.Get(id)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, id)
+	}
+	if task.ContainerID == "" {
+		return fmt.Errorf("%w: task %s", ErrNoContainer, id)
+	}
+	return w.Runtime.Logs(ctx, task.ContainerID, options, stdout, stderr)
+}
+
+func (w *Worker) ExecTask(ctx context.Context, id uuid.UUID, options containerrt.ExecOptions, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	task, ok := w.Db.Get(id)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrTaskNotFound, id)
+	}
+	if task.State != entities.TaskRunning || task.ContainerID == "" {
+		return 0, fmt.Errorf("%w: task %s", ErrNotRunning, id)
+	}
+	return w.Runtime.Exec(ctx, task.ContainerID, options, stdin, stdout, stderr)
+}
+
+// UpdateTasks checks the containers of running tasks every resync period and
+// whenever a task has been started, to pick up its published ports.
 func (w *Worker) UpdateTasks() {
 	for {
 		log.Println("Checking status of tasks")
 		w.updateTasks()
-		time.Sleep(15 * time.Second)
+		w.tasksStarted.Wait(w.resyncPeriod())
+	}
+}
+
+// recordExit copies how a task's container exited onto the task. A clean
+// exit completes the task, anything else fails it.
+func recordExit(t *entities.Task, state containerrt.ContainerState) {
+	t.ExitCode = state.ExitCode
+	t.OOMKilled = state.OOMKilled
+	t.TerminationMessage = state.Error
+	if !state.FinishedAt.IsZero() {
+		finished := state.FinishedAt
+		t.FinishedAt = &finished
+	} else {
+		now := time.Now()
+		t.FinishedAt = &now
+	}
+
+	switch {
+	case state.OOMKilled:
+		t.State = entities.TaskFailed
+		t.LastTerminationReason = entities.TerminationOOMKilled
+		if t.TerminationMessage == "" {
+			t.TerminationMessage = "container ran out of memory"
+		}
+	case state.ExitCode == 0 && state.Status == "exited":
+		t.State = entities.TaskCompleted
+		t.LastTerminationReason = entities.TerminationCompleted
+	default:
+		t.State = entities.TaskFailed
+		t.LastTerminationReason = entities.TerminationError
 	}
 }
 
 func (w *Worker) updateTasks() {
-	for id, task := range w.Db {
-		if task.State == entities.TaskRunning {
-			resp := w.InspectTask(*task)
-			if resp.Error != nil {
-				fmt.Printf("ERROR: %v\n", resp.Error)
-			}
+	for _, task := range w.Db.List() {
+		if task.State != entities.TaskRunning {
+			continue
+		}
+		resp := w.InspectTask(task)
+		if resp.Error != nil {
+			fmt.Printf("ERROR: %v\n", resp.Error)
+		}
 
+		// The task may have been stopped or restarted while its container
+		// was inspected; only the run that was inspected is updated.
+		exited := false
+		updated, _ := w.Db.Update(task.ID, func(t *entities.Task, ok bool) bool {
+			if !ok || t.State != entities.TaskRunning || t.ContainerID != task.ContainerID {
+				return false
+			}
 			if resp.Container == nil {
-				log.Printf("No container for running task %v\n", id)
-				w.Db[id].State = entities.TaskFailed
+				t.State = entities.TaskFailed
+				t.LastTerminationReason = entities.TerminationError
+				t.TerminationMessage = "container not found"
+				return true
 			}
-			if resp.Container.State.Status == "exited" {
-				log.Printf("Container %v is exited\n", id)
-				w.Db[id].State = entities.TaskFailed
+			if resp.Container.State.Status == "exited" || resp.Container.State.Status == "dead" {
+				recordExit(t, resp.Container.State)
+				exited = true
 			}
+			t.HostPorts = resp.Container.Ports
+			return true
+		})
 
-			w.Db[id].HostPorts = resp.Container.NetworkSettings.Ports
+		if resp.Container == nil {
+			log.Printf("No container for running task %v\n", task.ID)
+		} else if exited {
+			log.Printf("Container %v for task %v exited with code %d (%s)\n",
+				resp.Container.ID, task.ID, updated.ExitCode, updated.LastTerminationReason)
 		}
 	}
 }
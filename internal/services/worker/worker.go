@@ -1,16 +1,48 @@
 package worker
 
 import (
-	"github.com/golang-collections/collections/queue"
+	"errors"
 	"github.com/google/uuid"
 	"orc/domain/entities"
+	"orc/internal/infrastructure/containerrt"
+	"orc/internal/infrastructure/store"
+	"orc/pkg/xqueue"
 	"orc/pkg/xstats"
+	"orc/pkg/xsync"
+	"sync"
+	"time"
+)
+
+const (
+	defaultConcurrency  = 4
+	defaultResyncPeriod = 15 * time.Second
+)
+
+var (
+	ErrTaskNotFound = errors.New("task not found")
+	ErrNoContainer  = errors.New("task has no container")
+	ErrNotRunning   = errors.New("task is not running")
 )
 
 type Worker struct {
 	Name      string
-	Queue     queue.Queue
-	Db        map[uuid.UUID]*entities.Task
+	Queue     *xqueue.Queue[entities.TaskEvent]
+	Db        store.Store[uuid.UUID, entities.Task]
 	TaskCount int
 	Stats     *xstats.Stats
+	Runtime   containerrt.Runtime
+	// RegistryAuths holds the credentials for private registries, keyed by
+	// registry host. Credentials set on a task take precedence.
+	RegistryAuths map[string]entities.RegistryAuth
+	// Concurrency is how many task events are applied at once, 4 if unset.
+	Concurrency int
+	// ResyncPeriod is how often the work loops run when nothing wakes them,
+	// 15 seconds if unset.
+	ResyncPeriod time.Duration
+
+	// mu guards Stats and TaskCount.
+	mu sync.Mutex
+
+	tasksAdded   xsync.Signal
+	tasksStarted xsync.Signal
 }
@@ -0,0 +1,278 @@
+package worker
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"net"
+	"orc/domain/entities"
+	"orc/internal/infrastructure/fake"
+	"orc/internal/infrastructure/store"
+	"orc/pkg/xqueue"
+	"testing"
+	"time"
+)
+
+func newTestWorker(rt *fake.Runtime) *Worker {
+	return &Worker{
+		Name:    "test-worker",
+		Queue:   xqueue.NewQueue[entities.TaskEvent](),
+		Db:      store.NewMemory[uuid.UUID, entities.Task](),
+		Runtime: rt,
+	}
+}
+
+func newTestTask(image string) entities.Task {
+	return entities.Task{
+		ID:    uuid.New(),
+		Name:  "task-" + uuid.NewString(),
+		State: entities.TaskScheduled,
+		Image: image,
+	}
+}
+
+func TestContainerExit(t *testing.T) {
+	tests := []struct {
+		name     string
+		behavior fake.Behavior
+		exit     func(rt *fake.Runtime, id string) error
+		state    entities.TaskState
+		reason   string
+		exitCode int
+	}{
+		{
+			name:     "exit 0",
+			behavior: fake.Behavior{ExitAfter: time.Millisecond, ExitCode: 0},
+			state:    entities.TaskCompleted,
+			reason:   entities.TerminationCompleted,
+			exitCode: 0,
+		},
+		{
+			name:     "exit 1",
+			behavior: fake.Behavior{ExitAfter: time.Millisecond, ExitCode: 1},
+			state:    entities.TaskFailed,
+			reason:   entities.TerminationError,
+			exitCode: 1,
+		},
+		{
+			name:     "crash",
+			exit:     func(rt *fake.Runtime, id string) error { return rt.Crash(id, false) },
+			state:    entities.TaskFailed,
+			reason:   entities.TerminationError,
+			exitCode: 137,
+		},
+		{
+			name:     "oom killed",
+			exit:     func(rt *fake.Runtime, id string) error { return rt.Crash(id, true) },
+			state:    entities.TaskFailed,
+			reason:   entities.TerminationOOMKilled,
+			exitCode: 137,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := fake.NewRuntime()
+			rt.Script("app:1.0", tt.behavior)
+			w := newTestWorker(rt)
+			task := newTestTask("app:1.0")
+
+			result := w.RunTask(entities.TaskEvent{State: task.State, Task: task})
+			if result.Error != nil {
+				t.Fatalf("RunTask: %v", result.Error)
+			}
+			if tt.exit != nil {
+				if err := tt.exit(rt, result.ContainerID); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				time.Sleep(5 * tt.behavior.ExitAfter)
+			}
+			w.updateTasks()
+
+			got, _ := w.Db.Get(task.ID)
+			if got.State != tt.state {
+				t.Errorf("state = %v, want %v", got.State, tt.state)
+			}
+			if got.LastTerminationReason != tt.reason {
+				t.Errorf("termination reason = %q, want %q", got.LastTerminationReason, tt.reason)
+			}
+			if got.ExitCode != tt.exitCode {
+				t.Errorf("exit code = %d, want %d", got.ExitCode, tt.exitCode)
+			}
+			if got.FinishedAt == nil {
+				t.Error("FinishedAt not set")
+			}
+
+			// The exited container is removed when the task is restarted,
+			// so its name can be reused.
+			restarted := task
+			restarted.RestartCount++
+			result = w.RunTask(entities.TaskEvent{State: entities.TaskScheduled, Task: restarted})
+			if result.Error != nil {
+				t.Fatalf("restarting: %v", result.Error)
+			}
+			containers := rt.Containers()
+			if len(containers) != 1 || containers[0].ID != result.ContainerID {
+				t.Errorf("containers after restart = %+v, want only %s", containers, result.ContainerID)
+			}
+		})
+	}
+}
+
+// eventually polls cond until it holds or a second has passed.
+func eventually(cond func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return true
+}
+
+func TestSlowPull(t *testing.T) {
+	rt := fake.NewRuntime()
+	rt.Script("app:1.0", fake.Behavior{PullDelay: 500 * time.Millisecond})
+	w := newTestWorker(rt)
+	w.Concurrency = 2
+	w.ResyncPeriod = 20 * time.Millisecond
+	go w.RunTasks()
+
+	task := newTestTask("app:1.0")
+	w.AddTask(entities.TaskEvent{ID: uuid.New(), State: task.State, Task: task})
+	pulling := eventually(func() bool {
+		got, _ := w.Db.Get(task.ID)
+		return got.ImagePull != nil && got.ImagePull.Status == "Downloading"
+	})
+	if !pulling {
+		t.Fatal("pull progress was never recorded")
+	}
+
+	// Other tasks do not wait for the pull.
+	other := newTestTask("other:1.0")
+	w.AddTask(entities.TaskEvent{ID: uuid.New(), State: other.State, Task: other})
+	started := eventually(func() bool {
+		got, _ := w.Db.Get(other.ID)
+		return got.State == entities.TaskRunning
+	})
+	if !started {
+		t.Fatal("second task did not start while the first one was pulling")
+	}
+	if got, _ := w.Db.Get(task.ID); got.State != entities.TaskScheduled {
+		t.Errorf("state while pulling = %v, want %v", got.State, entities.TaskScheduled)
+	}
+
+	running := eventually(func() bool {
+		got, _ := w.Db.Get(task.ID)
+		return got.State == entities.TaskRunning
+	})
+	if !running {
+		t.Fatal("task did not start once its image was pulled")
+	}
+	got, _ := w.Db.Get(task.ID)
+	if got.ImagePull == nil || got.ImagePull.Status != "Pulled" {
+		t.Errorf("pull status = %+v, want Pulled", got.ImagePull)
+	}
+	if rt.Pulls() != 2 {
+		t.Errorf("pulls = %d, want 2", rt.Pulls())
+	}
+}
+
+func TestPullError(t *testing.T) {
+	rt := fake.NewRuntime()
+	rt.Script("app:1.0", fake.Behavior{PullError: errors.New("manifest unknown")})
+	w := newTestWorker(rt)
+	task := newTestTask("app:1.0")
+
+	if result := w.RunTask(entities.TaskEvent{State: task.State, Task: task}); result.Error == nil {
+		t.Fatal("RunTask succeeded, want pull error")
+	}
+	got, _ := w.Db.Get(task.ID)
+	if got.State != entities.TaskFailed {
+		t.Errorf("state = %v, want %v", got.State, entities.TaskFailed)
+	}
+	if got.ImagePull == nil || got.ImagePull.Status != "Failed" {
+		t.Errorf("pull status = %+v, want Failed", got.ImagePull)
+	}
+	if len(rt.Containers()) != 0 {
+		t.Errorf("%d containers started, want none", len(rt.Containers()))
+	}
+}
+
+func TestStopTaskVolumes(t *testing.T) {
+	for _, removeVolumes := range []bool{false, true} {
+		rt := fake.NewRuntime()
+		w := newTestWorker(rt)
+		task := newTestTask("app:1.0")
+		task.Volumes = []entities.Volume{{Type: entities.VolumeNamed, Source: "data", Target: "/data"}}
+
+		if result := w.RunTask(entities.TaskEvent{State: task.State, Task: task}); result.Error != nil {
+			t.Fatalf("RunTask: %v", result.Error)
+		}
+		running, _ := w.Db.Get(task.ID)
+		running.State = entities.TaskCompleted
+		result := w.RunTask(entities.TaskEvent{State: running.State, Task: running, RemoveVolumes: removeVolumes})
+		if result.Error != nil {
+			t.Fatalf("stopping task: %v", result.Error)
+		}
+
+		kept := len(rt.Volumes()) == 1
+		if kept == removeVolumes {
+			t.Errorf("removeVolumes=%v: volumes after stop = %v", removeVolumes, rt.Volumes())
+		}
+	}
+}
+
+func TestCheckPorts(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	_, inUse, _ := net.SplitHostPort(l.Addr().String())
+
+	freePort, otherPort := unusedPort(t), unusedPort(t)
+
+	tests := []struct {
+		name     string
+		other    entities.TaskState
+		bindings map[string]string
+		conflict bool
+	}{
+		{"free port", entities.TaskRunning, map[string]string{"80/tcp": "127.0.0.1:" + freePort}, false},
+		{"used by a running task", entities.TaskRunning, map[string]string{"80/tcp": "127.0.0.1:" + otherPort}, true},
+		{"used by a completed task", entities.TaskCompleted, map[string]string{"80/tcp": "127.0.0.1:" + otherPort}, false},
+		{"used by another process", entities.TaskRunning, map[string]string{"80/tcp": "127.0.0.1:" + inUse}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWorker(fake.NewRuntime())
+			other := newTestTask("app:1.0")
+			other.State = tt.other
+			other.PortBindings = map[string]string{"8080/tcp": otherPort}
+			w.Db.Put(other.ID, other)
+
+			task := newTestTask("app:1.0")
+			task.PortBindings = tt.bindings
+
+			err := w.checkPorts(task)
+			if tt.conflict && err == nil {
+				t.Fatal("no conflict reported")
+			}
+			if !tt.conflict && err != nil {
+				t.Fatalf("unexpected conflict: %v", err)
+			}
+		})
+	}
+}
+
+func unusedPort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
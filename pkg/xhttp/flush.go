@@ -0,0 +1,44 @@
+package xhttp
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// FlushWriter flushes the response after every write so streamed output
+// reaches the client immediately. It is safe for concurrent writers.
+type FlushWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	f       http.Flusher
+	written bool
+}
+
+func NewFlushWriter(w http.ResponseWriter) *FlushWriter {
+	f, _ := w.(http.Flusher)
+	return &FlushWriter{w: w, f: f}
+}
+
+func (fw *FlushWriter) Write(p []byte) (int, error) {
+	// An empty write would still send the response status.
+	if len(p) == 0 {
+		return 0, nil
+	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	n, err := fw.w.Write(p)
+	fw.written = fw.written || n > 0
+	if fw.f != nil {
+		fw.f.Flush()
+	}
+	return n, err
+}
+
+// Written reports whether any bytes have been sent, after which the response
+// status can no longer be changed.
+func (fw *FlushWriter) Written() bool {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.written
+}
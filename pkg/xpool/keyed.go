@@ -0,0 +1,61 @@
+package xpool
+
+import "sync"
+
+// Keyed runs submitted functions with at most size of them running at once.
+// Functions submitted with the same key run one after another in the order
+// they were submitted, functions with different keys run concurrently.
+type Keyed[K comparable] struct {
+	mu      sync.Mutex
+	slots   chan struct{}
+	pending map[K][]func()
+	wg      sync.WaitGroup
+}
+
+func NewKeyed[K comparable](size int) *Keyed[K] {
+	if size < 1 {
+		size = 1
+	}
+	return &Keyed[K]{
+		slots:   make(chan struct{}, size),
+		pending: make(map[K][]func()),
+	}
+}
+
+func (p *Keyed[K]) Submit(key K, fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.wg.Add(1)
+	if queued, busy := p.pending[key]; busy {
+		p.pending[key] = append(queued, fn)
+		return
+	}
+	p.pending[key] = nil
+	go p.run(key, fn)
+}
+
+// Wait blocks until every submitted function has returned.
+func (p *Keyed[K]) Wait() {
+	p.wg.Wait()
+}
+
+// run executes fn and then the functions queued behind it for the same key.
+func (p *Keyed[K]) run(key K, fn func()) {
+	for {
+		p.slots <- struct{}{}
+		fn()
+		<-p.slots
+		p.wg.Done()
+
+		p.mu.Lock()
+		queued := p.pending[key]
+		if len(queued) == 0 {
+			delete(p.pending, key)
+			p.mu.Unlock()
+			return
+		}
+		fn = queued[0]
+		p.pending[key] = queued[1:]
+		p.mu.Unlock()
+	}
+}
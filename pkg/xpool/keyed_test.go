@@ -0,0 +1,92 @@
+package xpool
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyedOrderWithinKey(t *testing.T) {
+	p := NewKeyed[string](4)
+	var mu sync.Mutex
+	var got []int
+	for i := range 100 {
+		p.Submit("a", func() {
+			mu.Lock()
+			got = append(got, i)
+			mu.Unlock()
+		})
+	}
+	p.Wait()
+
+	if len(got) != 100 {
+		t.Fatalf("ran %d functions, want 100", len(got))
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("function %d ran at position %d", v, i)
+		}
+	}
+}
+
+func TestKeyedParallelAcrossKeys(t *testing.T) {
+	p := NewKeyed[int](3)
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	for key := range 3 {
+		p.Submit(key, func() {
+			started <- struct{}{}
+			<-release
+		})
+	}
+
+	for range 3 {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("functions with different keys did not run concurrently")
+		}
+	}
+	close(release)
+	p.Wait()
+}
+
+func TestKeyedSizeCap(t *testing.T) {
+	const size = 2
+	p := NewKeyed[int](size)
+	var running, peak atomic.Int32
+	for key := range 10 {
+		p.Submit(key, func() {
+			n := running.Add(1)
+			for {
+				old := peak.Load()
+				if n <= old || peak.CompareAndSwap(old, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			running.Add(-1)
+		})
+	}
+	p.Wait()
+
+	if peak.Load() != size {
+		t.Errorf("at most %d functions ran at once, want %d", peak.Load(), size)
+	}
+}
+
+func TestKeyedSerialWithinKey(t *testing.T) {
+	p := NewKeyed[string](4)
+	var running atomic.Int32
+	for range 20 {
+		p.Submit("a", func() {
+			if running.Add(1) != 1 {
+				t.Error("functions with the same key overlapped")
+			}
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+		})
+	}
+	p.Wait()
+}
@@ -0,0 +1,101 @@
+package xqueue
+
+import (
+	"container/heap"
+	"slices"
+	"sync"
+)
+
+// PriorityQueue pops the item with the highest priority first. Items with
+// equal priority are popped in the order they were pushed. It is safe for
+// concurrent use.
+type PriorityQueue[T any] struct {
+	mu       sync.Mutex
+	items    *items[T]
+	priority func(T) int
+	seq      uint64
+}
+
+func NewPriorityQueue[T any](priority func(T) int) *PriorityQueue[T] {
+	return &PriorityQueue[T]{
+		items:    &items[T]{},
+		priority: priority,
+	}
+}
+
+func (q *PriorityQueue[T]) Enqueue(value T) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	heap.Push(q.items, item[T]{
+		value:    value,
+		priority: q.priority(value),
+		seq:      q.seq,
+	})
+	q.seq++
+}
+
+// Dequeue removes and returns the highest priority item. The second value is
+// false if the queue is empty.
+func (q *PriorityQueue[T]) Dequeue() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.items.Len() == 0 {
+		var zero T
+		return zero, false
+	}
+	return heap.Pop(q.items).(item[T]).value, true
+}
+
+// DeleteFunc removes every item for which del returns true and returns how
+// many were removed.
+func (q *PriorityQueue[T]) DeleteFunc(del func(T) bool) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	before := q.items.Len()
+	*q.items = slices.DeleteFunc(*q.items, func(it item[T]) bool {
+		return del(it.value)
+	})
+	heap.Init(q.items)
+	return before - q.items.Len()
+}
+
+func (q *PriorityQueue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.items.Len()
+}
+
+type item[T any] struct {
+	value    T
+	priority int
+	seq      uint64
+}
+
+type items[T any] []item[T]
+
+func (h items[T]) Len() int {
+	return len(h)
+}
+
+func (h items[T]) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h items[T]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *items[T]) Push(x any) {
+	*h = append(*h, x.(item[T]))
+}
+
+func (h *items[T]) Pop() any {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	*h = old[:n-1]
+	return it
+}
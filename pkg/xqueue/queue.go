@@ -0,0 +1,40 @@
+package xqueue
+
+import "sync"
+
+// Queue is a first-in, first-out queue safe for concurrent use.
+type Queue[T any] struct {
+	mu    sync.Mutex
+	items []T
+}
+
+func NewQueue[T any]() *Queue[T] {
+	return &Queue[T]{}
+}
+
+func (q *Queue[T]) Enqueue(value T) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, value)
+}
+
+// Dequeue removes and returns the oldest item. The second value is false if
+// the queue is empty.
+func (q *Queue[T]) Dequeue() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var zero T
+	if len(q.items) == 0 {
+		return zero, false
+	}
+	value := q.items[0]
+	q.items[0] = zero
+	q.items = q.items[1:]
+	return value, true
+}
+
+func (q *Queue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
@@ -0,0 +1,85 @@
+package xqueue
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestQueueOrder(t *testing.T) {
+	q := NewQueue[int]()
+	for i := range 5 {
+		q.Enqueue(i)
+	}
+	if q.Len() != 5 {
+		t.Fatalf("Len = %d, want 5", q.Len())
+	}
+	for i := range 5 {
+		if v, ok := q.Dequeue(); !ok || v != i {
+			t.Fatalf("Dequeue = %d, %v, want %d, true", v, ok, i)
+		}
+	}
+	if _, ok := q.Dequeue(); ok {
+		t.Error("Dequeue on an empty queue reported a value")
+	}
+}
+
+func TestQueueConcurrent(t *testing.T) {
+	const producers, items = 10, 100
+	q := NewQueue[int]()
+	var wg sync.WaitGroup
+	for p := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range items {
+				q.Enqueue(p*items + i)
+			}
+		}()
+	}
+
+	var mu sync.Mutex
+	seen := make(map[int]int)
+	for range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range items {
+				v, ok := q.Dequeue()
+				for !ok {
+					v, ok = q.Dequeue()
+				}
+				mu.Lock()
+				seen[v]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != producers*items {
+		t.Fatalf("dequeued %d distinct values, want %d", len(seen), producers*items)
+	}
+	for v, n := range seen {
+		if n != 1 {
+			t.Errorf("value %d dequeued %d times", v, n)
+		}
+	}
+}
+
+func TestPriorityQueueOrder(t *testing.T) {
+	type job struct {
+		name     string
+		priority int
+	}
+	q := NewPriorityQueue(func(j job) int { return j.priority })
+	q.Enqueue(job{"low", 0})
+	q.Enqueue(job{"high-1", 5})
+	q.Enqueue(job{"high-2", 5})
+	q.Enqueue(job{"mid", 2})
+
+	for _, want := range []string{"high-1", "high-2", "mid", "low"} {
+		if j, ok := q.Dequeue(); !ok || j.name != want {
+			t.Fatalf("Dequeue = %q, %v, want %q", j.name, ok, want)
+		}
+	}
+}
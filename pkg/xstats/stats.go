@@ -3,6 +3,7 @@ package xstats
 import (
 	linuxproc "github.com/c9s/goprocinfo/linux"
 	"log"
+	"runtime"
 )
 
 type Stats struct {
@@ -10,6 +11,7 @@ type Stats struct {
 	DiskStats *linuxproc.Disk
 	CPUStats  *linuxproc.CPUStat
 	LoadStats *linuxproc.LoadAvg
+	Cores     int
 	TaskCount int
 }
 
@@ -49,7 +51,7 @@ func (s *Stats) CPUsage() float64 {
 	if total == 0 {
 		return 0.0
 	}
-	return (float64(total) / float64(idle)) / float64(total)
+	return float64(nonIdle) / float64(total)
 }
 
 func GetStats() *Stats {
@@ -58,6 +60,7 @@ func GetStats() *Stats {
 		DiskStats: GetDiskInfo(),
 		CPUStats:  GetCPUStats(),
 		LoadStats: GetLoadAvg(),
+		Cores:     runtime.NumCPU(),
 	}
 }
 
@@ -0,0 +1,42 @@
+package xsync
+
+import (
+	"sync"
+	"time"
+)
+
+// Signal wakes a loop waiting for work. Notifications are coalesced: any
+// number of Notify calls while the loop is busy wake it once. The zero value
+// is ready to use.
+type Signal struct {
+	once sync.Once
+	c    chan struct{}
+}
+
+func (s *Signal) init() {
+	s.once.Do(func() {
+		s.c = make(chan struct{}, 1)
+	})
+}
+
+func (s *Signal) Notify() {
+	s.init()
+	select {
+	case s.c <- struct{}{}:
+	default:
+	}
+}
+
+// Wait blocks until the signal is notified or timeout has passed and reports
+// whether it was notified.
+func (s *Signal) Wait(timeout time.Duration) bool {
+	s.init()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-s.c:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
@@ -0,0 +1,50 @@
+package xsync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignalCoalesces(t *testing.T) {
+	var s Signal
+	for range 5 {
+		s.Notify()
+	}
+
+	if !s.Wait(time.Second) {
+		t.Fatal("Wait timed out after Notify")
+	}
+	if s.Wait(10 * time.Millisecond) {
+		t.Error("notifications were not coalesced into one wakeup")
+	}
+}
+
+func TestSignalTimeout(t *testing.T) {
+	var s Signal
+	start := time.Now()
+	if s.Wait(20 * time.Millisecond) {
+		t.Fatal("Wait reported a notification that never happened")
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Wait returned after %v, before its timeout", elapsed)
+	}
+}
+
+func TestSignalWakesWaiter(t *testing.T) {
+	var s Signal
+	woken := make(chan bool)
+	go func() {
+		woken <- s.Wait(time.Second)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	s.Notify()
+	select {
+	case ok := <-woken:
+		if !ok {
+			t.Error("Wait timed out instead of being woken")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Wait did not return")
+	}
+}